@@ -0,0 +1,80 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+type entity struct {
+	co cogo.Coroutine[int, int]
+}
+
+func TestEmbeddedTickAllocs(t *testing.T) {
+
+	e := &entity{}
+	e.co.Init(yieldForever_cogo, 0)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		e.co.Tick()
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected ticking an embedded coroutine to not allocate, but got %v allocations per tick", allocs)
+	}
+}
+
+func TestReusedSleeperAllocs(t *testing.T) {
+
+	c := cogo.New(sleepReused_cogo, &cogo.Sleeper{})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Tick()
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected yielding to a reused sleeper to not allocate, but got %v allocations per tick", allocs)
+	}
+}
+
+func TestPoolAllocs(t *testing.T) {
+
+	p := &cogo.Pool[int, int]{}
+	p.Put(p.New(yieldThrice_cogo, 0))
+
+	allocs := testing.AllocsPerRun(100, func() {
+
+		c := p.New(yieldThrice_cogo, 0)
+		for !c.Tick() {
+		}
+		p.Put(c)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected running a pooled coroutine to not allocate, but got %v allocations per run", allocs)
+	}
+}
+
+func TestResetAndLoopAllocs(t *testing.T) {
+
+	c := cogo.New(yieldThrice_cogo, 0)
+	allocs := testing.AllocsPerRun(100, func() {
+
+		for !c.Tick() {
+		}
+		c.Reset(0)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected restarting a coroutine with Reset to not allocate, but got %v allocations per run", allocs)
+	}
+
+	c.Loop = true
+	allocs = testing.AllocsPerRun(100, func() {
+		c.Tick()
+	})
+
+	if allocs != 0 {
+		t.Fatalf("expected ticking a looping coroutine to not allocate, but got %v allocations per tick", allocs)
+	}
+}
@@ -0,0 +1,206 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+const manyCount = 10_000
+
+func BenchmarkTick(b *testing.B) {
+
+	c := cogo.New(yieldForever_cogo, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+	}
+}
+
+func BenchmarkYieldToSleeper(b *testing.B) {
+
+	c := cogo.New(sleepForever_cogo, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+	}
+}
+
+func BenchmarkYieldToSleeperDelta(b *testing.B) {
+
+	c := cogo.New(sleepForever_cogo, 0)
+	info := cogo.TickInfo{Delta: time.Millisecond}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		info.Frame++
+		c.TickDelta(info)
+	}
+}
+
+func BenchmarkYieldToReusedSleeper(b *testing.B) {
+
+	c := cogo.New(sleepReused_cogo, &cogo.Sleeper{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+
+	p := &cogo.Pool[int, int]{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+
+		c := p.New(yieldThrice_cogo, 0)
+		for !c.Tick() {
+		}
+		p.Put(c)
+	}
+}
+
+// BenchmarkNested measures a parent running a child coroutine to completion, which takes 3 ticks
+func BenchmarkNested(b *testing.B) {
+
+	c := cogo.New(runChildrenForever_cogo, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+		c.Tick()
+		c.Tick()
+	}
+}
+
+// BenchmarkTickMany measures one frame where many coroutines are ticked
+func BenchmarkTickMany(b *testing.B) {
+
+	coroutines := make([]*cogo.Coroutine[int, int], manyCount)
+	for i := range coroutines {
+		coroutines[i] = cogo.New(yieldForever_cogo, 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range coroutines {
+			c.Tick()
+		}
+	}
+}
+
+// BenchmarkSchedulerTickMany is BenchmarkTickMany with the coroutines owned by a scheduler
+func BenchmarkSchedulerTickMany(b *testing.B) {
+
+	s := cogo.NewScheduler()
+	for i := 0; i < manyCount; i++ {
+		s.Add(cogo.New(yieldForever_cogo, 0))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Tick()
+	}
+}
+
+// BenchmarkParallelSchedulerTickMany is BenchmarkSchedulerTickMany with the coroutines ticked on GOMAXPROCS workers
+func BenchmarkParallelSchedulerTickMany(b *testing.B) {
+
+	s := cogo.NewParallelScheduler(0)
+	defer s.Close()
+
+	for i := 0; i < manyCount; i++ {
+		s.Add(cogo.New(yieldForever_cogo, 0))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Tick()
+	}
+}
+
+// goroutineStepper is the goroutine equivalent of a coroutine: every resume sends on a channel and waits for the goroutine to yield a value back
+type goroutineStepper struct {
+	resume chan struct{}
+	yield  chan int
+}
+
+func newGoroutineStepper() *goroutineStepper {
+
+	s := &goroutineStepper{
+		resume: make(chan struct{}),
+		yield:  make(chan int),
+	}
+
+	go func() {
+		for range s.resume {
+			s.yield <- 0
+		}
+	}()
+
+	return s
+}
+
+func (s *goroutineStepper) step() int {
+	s.resume <- struct{}{}
+	return <-s.yield
+}
+
+func (s *goroutineStepper) stop() {
+	close(s.resume)
+}
+
+func BenchmarkGoroutineStep(b *testing.B) {
+
+	s := newGoroutineStepper()
+	defer s.stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.step()
+	}
+}
+
+// BenchmarkGoroutineStepMany is the goroutine equivalent of BenchmarkTickMany
+func BenchmarkGoroutineStepMany(b *testing.B) {
+
+	steppers := make([]*goroutineStepper, manyCount)
+	for i := range steppers {
+		steppers[i] = newGoroutineStepper()
+	}
+
+	defer func() {
+		for _, s := range steppers {
+			s.stop()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+
+		// Resume everything first so the goroutines can run in parallel like a real frame would
+		for _, s := range steppers {
+			s.resume <- struct{}{}
+		}
+
+		for _, s := range steppers {
+			<-s.yield
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func TestSleeperWithFakeClock(t *testing.T) {
+
+	clock := cogo.NewFakeClock(time.Time{})
+	c := cogo.New(sleepOneSecond_cogo, 0)
+	c.Clock = clock
+
+	if c.Tick() {
+		t.Fatalf("expected coroutine to be sleeping after the first tick")
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	if c.Tick() {
+		t.Fatalf("expected coroutine to be sleeping before a second passed")
+	}
+
+	clock.Advance(time.Millisecond)
+	if !c.Tick() {
+		t.Fatalf("expected coroutine to be done after a second passed, but it's at %s", c.Where())
+	}
+}
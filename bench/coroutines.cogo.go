@@ -0,0 +1,188 @@
+// Code generated by 'cogo'; DO NOT EDIT.
+// cogo-hash: 11cb51d439a2cce1fb8868ee27e8c12accdb8a829e84274a5ddc87c6b99cfb69
+package bench
+
+import (
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func yieldForever_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case yieldForever_cogo_State1:
+		goto cogo_3
+	}
+cogo_1:
+	;
+	{
+		c.Suspend(yieldForever_cogo_State1)
+		return
+	}
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	yieldForever_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: yieldForever_cogo_State1, Kind: "YieldNone", File: "coroutines.go", Line: 17},
+	}, yieldForever_cogo, yieldForever)
+}
+
+func sleepForever_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case sleepForever_cogo_State1:
+		goto cogo_3
+	}
+cogo_1:
+	;
+	{
+		c.SuspendTo(sleepForever_cogo_State1, cogo.NewSleeper(0))
+		return
+	}
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	sleepForever_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: sleepForever_cogo_State1, Kind: "YieldTo", File: "coroutines.go", Line: 24},
+	}, sleepForever_cogo, sleepForever)
+}
+
+func yieldThrice_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case yieldThrice_cogo_State1:
+		goto cogo_1
+	case yieldThrice_cogo_State2:
+		goto cogo_2
+	case yieldThrice_cogo_State3:
+		goto cogo_3
+	}
+	{
+		c.Suspend(yieldThrice_cogo_State1)
+		c.Out = 1
+		return
+	}
+cogo_1:
+	;
+	{
+		c.Suspend(yieldThrice_cogo_State2)
+		c.Out = 2
+		return
+	}
+cogo_2:
+	;
+	{
+		c.Suspend(yieldThrice_cogo_State3)
+		c.Out = 3
+		return
+	}
+cogo_3:
+	;
+	c.MarkDone()
+}
+
+const (
+	yieldThrice_cogo_State1 int32 = 1
+	yieldThrice_cogo_State2 int32 = 2
+	yieldThrice_cogo_State3 int32 = 3
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: yieldThrice_cogo_State1, Kind: "Yield", File: "coroutines.go", Line: 31},
+		{State: yieldThrice_cogo_State2, Kind: "Yield", File: "coroutines.go", Line: 32},
+		{State: yieldThrice_cogo_State3, Kind: "Yield", File: "coroutines.go", Line: 33},
+	}, yieldThrice_cogo, yieldThrice)
+}
+
+func sleepOneSecond_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case sleepOneSecond_cogo_State1:
+		goto cogo_1
+	}
+	{
+		c.SuspendTo(sleepOneSecond_cogo_State1, cogo.NewSleeper(time.Second))
+		return
+	}
+cogo_1:
+	;
+	c.MarkDone()
+}
+
+const (
+	sleepOneSecond_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: sleepOneSecond_cogo_State1, Kind: "YieldTo", File: "coroutines.go", Line: 37},
+	}, sleepOneSecond_cogo, sleepOneSecond)
+}
+
+func runChildrenForever_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case runChildrenForever_cogo_State1:
+		goto cogo_3
+	}
+cogo_1:
+	;
+	{
+		c.SuspendTo(runChildrenForever_cogo_State1, cogo.New(yieldThrice_cogo, 0))
+		return
+	}
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	runChildrenForever_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: runChildrenForever_cogo_State1, Kind: "YieldTo", File: "coroutines.go", Line: 43},
+	}, runChildrenForever_cogo, runChildrenForever)
+}
+
+func sleepReused_cogo(c *cogo.Coroutine[*cogo.Sleeper, int]) {
+	switch c.State() {
+	case sleepReused_cogo_State1:
+		goto cogo_3
+	}
+cogo_1:
+	;
+	{
+		c.SuspendTo(sleepReused_cogo_State1, c.In.Reset(0))
+		return
+	}
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	sleepReused_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: sleepReused_cogo_State1, Kind: "YieldTo", File: "coroutines.go", Line: 51},
+	}, sleepReused_cogo, sleepReused)
+}
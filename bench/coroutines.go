@@ -0,0 +1,53 @@
+//go:generate cogo
+
+// Package bench has benchmarks of cogo and of the same work done with goroutines and channels, or iter.Pull.
+// Run them with 'go test -bench . ./bench'
+package bench
+
+import (
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+// yieldForever is the smallest possible coroutine, so ticking it measures the overhead of Tick itself
+func yieldForever(c *cogo.Coroutine[int, int]) {
+
+	for {
+		c.YieldNone()
+	}
+}
+
+func sleepForever(c *cogo.Coroutine[int, int]) {
+
+	for {
+		c.YieldTo(cogo.NewSleeper(0))
+	}
+}
+
+// yieldThrice finishes after yielding 3 times, and is used as a child coroutine
+func yieldThrice(c *cogo.Coroutine[int, int]) {
+
+	c.Yield(1)
+	c.Yield(2)
+	c.Yield(3)
+}
+
+func sleepOneSecond(c *cogo.Coroutine[int, int]) {
+	c.YieldTo(cogo.NewSleeper(time.Second))
+}
+
+func runChildrenForever(c *cogo.Coroutine[int, int]) {
+
+	for {
+		c.YieldTo(cogo.New(yieldThrice_cogo, 0))
+	}
+}
+
+// sleepReused yields to the sleeper it gets as input, which is reset instead of allocating a new sleeper every time
+func sleepReused(c *cogo.Coroutine[*cogo.Sleeper, int]) {
+
+	for {
+		c.YieldTo(c.In.Reset(0))
+	}
+}
@@ -0,0 +1,153 @@
+// Code generated by 'cogo'; DO NOT EDIT.
+// cogo-hash: 0b21f7bde1d0953e51b693ac7eda98eef8bdad2531457cd73eabc9c07dfcbd2e
+package bench
+
+import "github.com/bloeys/cogo/cogo"
+
+func nested0_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case nested0_cogo_State1:
+		goto cogo_3
+	}
+cogo_1:
+	;
+	{
+		c.Suspend(nested0_cogo_State1)
+		c.Out = 0
+		return
+	}
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	nested0_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: nested0_cogo_State1, Kind: "Yield", File: "nested.go", Line: 11},
+	}, nested0_cogo, nested0)
+}
+
+func nested4_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case nested4_cogo_State1:
+		goto cogo_7
+	}
+cogo_1:
+	;
+	if !(c.In >= 0) {
+		goto cogo_3
+	}
+	if !(c.In >= 0) {
+		goto cogo_4
+	}
+	if !(c.In >= 0) {
+		goto cogo_5
+	}
+	if !(c.In >= 0) {
+		goto cogo_6
+	}
+	{
+		c.Suspend(nested4_cogo_State1)
+		c.Out = 4
+		return
+	}
+cogo_7:
+	;
+cogo_6:
+	;
+cogo_5:
+	;
+cogo_4:
+	;
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	nested4_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: nested4_cogo_State1, Kind: "Yield", File: "nested.go", Line: 22},
+	}, nested4_cogo, nested4)
+}
+
+func nested8_cogo(c *cogo.Coroutine[int, int]) {
+	switch c.State() {
+	case nested8_cogo_State1:
+		goto cogo_13
+	}
+cogo_1:
+	;
+	if !(c.In >= 0) {
+		goto cogo_3
+	}
+cogo_4:
+	;
+	if !(c.In >= 0) {
+		goto cogo_5
+	}
+	if !(c.In >= 0) {
+		goto cogo_6
+	}
+cogo_7:
+	;
+	if !(c.In >= 0) {
+		goto cogo_8
+	}
+	if !(c.In >= 0) {
+		goto cogo_9
+	}
+cogo_10:
+	;
+	if !(c.In >= 0) {
+		goto cogo_11
+	}
+	if !(c.In >= 0) {
+		goto cogo_12
+	}
+	{
+		c.Suspend(nested8_cogo_State1)
+		c.Out = 8
+		return
+	}
+cogo_13:
+	;
+cogo_12:
+	;
+	goto cogo_10
+cogo_11:
+	;
+cogo_9:
+	;
+	goto cogo_7
+cogo_8:
+	;
+cogo_6:
+	;
+	goto cogo_4
+cogo_5:
+	;
+cogo_3:
+	;
+	goto cogo_1
+
+}
+
+const (
+	nested8_cogo_State1 int32 = 1
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: nested8_cogo_State1, Kind: "Yield", File: "nested.go", Line: 40},
+	}, nested8_cogo, nested8)
+}
@@ -0,0 +1,49 @@
+//go:generate cogo
+package bench
+
+import "github.com/bloeys/cogo/cogo"
+
+// The coroutines below yield forever from different nesting depths, which shouldn't change the cost of resuming them
+
+func nested0(c *cogo.Coroutine[int, int]) {
+
+	for {
+		c.Yield(0)
+	}
+}
+
+func nested4(c *cogo.Coroutine[int, int]) {
+
+	for {
+		if c.In >= 0 {
+			if c.In >= 0 {
+				if c.In >= 0 {
+					if c.In >= 0 {
+						c.Yield(4)
+					}
+				}
+			}
+		}
+	}
+}
+
+func nested8(c *cogo.Coroutine[int, int]) {
+
+	for {
+		if c.In >= 0 {
+			for c.In >= 0 {
+				if c.In >= 0 {
+					for c.In >= 0 {
+						if c.In >= 0 {
+							for c.In >= 0 {
+								if c.In >= 0 {
+									c.Yield(8)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
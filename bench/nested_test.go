@@ -0,0 +1,24 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func benchmarkResume(b *testing.B, f cogo.CoroutineFunc[int, int]) {
+
+	c := cogo.New(f, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick()
+	}
+}
+
+func BenchmarkResumeDepth(b *testing.B) {
+	b.Run("0", func(b *testing.B) { benchmarkResume(b, nested0_cogo) })
+	b.Run("4", func(b *testing.B) { benchmarkResume(b, nested4_cogo) })
+	b.Run("8", func(b *testing.B) { benchmarkResume(b, nested8_cogo) })
+}
@@ -0,0 +1,46 @@
+//go:build go1.23
+
+package bench
+
+import (
+	"iter"
+	"testing"
+)
+
+func yieldForeverSeq(yield func(int) bool) {
+	for yield(0) {
+	}
+}
+
+// BenchmarkPull is the iter.Pull equivalent of BenchmarkTick
+func BenchmarkPull(b *testing.B) {
+
+	next, stop := iter.Pull(yieldForeverSeq)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next()
+	}
+}
+
+// BenchmarkPullMany is the iter.Pull equivalent of BenchmarkTickMany
+func BenchmarkPullMany(b *testing.B) {
+
+	nexts := make([]func() (int, bool), manyCount)
+	for i := range nexts {
+
+		next, stop := iter.Pull(yieldForeverSeq)
+		defer stop()
+		nexts[i] = next
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, next := range nexts {
+			next()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// genVersion is part of the hash of every source file, so bumping it makes all generated files outdated.
+	// It must be bumped whenever the generated code changes
+	genVersion = "8"
+
+	genFileHeaderLine = "// Code generated by 'cogo'; DO NOT EDIT.\n"
+	genFileHashPrefix = "// cogo-hash: "
+)
+
+// getGenFileHeader returns the comment written at the top of generated files. The hash of the
+// source file lets future runs know whether the generated file is up to date
+func getGenFileHeader(srcHash string) string {
+	return genFileHeaderLine + genFileHashPrefix + srcHash + "\n"
+}
+
+// readPkgSrcs reads the source files among fNames, which are the files of one package, skipping generated ones
+func readPkgSrcs(fNames []string) (srcs map[string][]byte) {
+
+	srcs = map[string][]byte{}
+	for _, fName := range fNames {
+
+		if isCogoFile(fName) {
+			continue
+		}
+
+		src, err := os.ReadFile(fName)
+		if err != nil {
+			panic("Failed to read file " + fName + ". Err: " + err.Error())
+		}
+
+		srcs[fName] = src
+	}
+
+	return srcs
+}
+
+// getSrcHashes returns the hash of every file in srcs, which are the source files of one package. Besides the file
+// itself, each hash covers the rest of the package, since other files can change what is generated from it (e.g. by
+// adding '//cogo:yield' to a function it calls), so changing one file makes the whole package outdated.
+//
+// Changes in other packages aren't tracked, so after changing a yield macro of another package -force is needed
+func getSrcHashes(srcs map[string][]byte) (srcHashes map[string]string) {
+
+	fNames := make([]string, 0, len(srcs))
+	for fName := range srcs {
+		fNames = append(fNames, fName)
+	}
+	sort.Strings(fNames)
+
+	// Only base names are used so that the hashes are the same wherever the package is
+	pkgHash := sha256.New()
+	for _, fName := range fNames {
+		pkgHash.Write([]byte(filepath.Base(fName)))
+		pkgHash.Write([]byte{0})
+		pkgHash.Write(srcs[fName])
+		pkgHash.Write([]byte{0})
+	}
+	pkgSum := pkgHash.Sum(nil)
+
+	srcHashes = make(map[string]string, len(srcs))
+	for _, fName := range fNames {
+
+		h := sha256.New()
+		h.Write([]byte(genVersion))
+		h.Write([]byte{0})
+		h.Write(srcs[fName])
+		h.Write([]byte{0})
+		h.Write(pkgSum)
+		srcHashes[fName] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return srcHashes
+}
+
+// mayHaveCoroutines is a quick check that returns false if src definitely has no coroutines. Files that mention coroutines
+// are parsed (without types) to find functions that take a '*cogo.Coroutine[...]' or are marked with '//cogo:coroutine',
+// since a file that only uses coroutines (e.g. 'var c *cogo.Coroutine[int, int]') has no generated file to tell it's up to date.
+// Telling yields apart from calls to yield macros needs types, so a file with a function that takes a coroutine but never
+// yields is still processed on every run
+func mayHaveCoroutines(src []byte) bool {
+
+	if !bytes.Contains(src, []byte("cogo.Coroutine[")) && !bytes.Contains(src, []byte(directivePrefix+"coroutine")) {
+		return false
+	}
+
+	// Files that don't parse are left for the full load to report
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return true
+	}
+
+	if fileIsIgnored(fset, f) {
+		return false
+	}
+
+	for _, decl := range f.Decls {
+
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		if getCoroutineParamNameFromFuncDecl(funcDecl) != "" {
+			return true
+		}
+
+		for _, d := range parseDirectives(fset, funcDecl.Doc) {
+			if d.Name == "coroutine" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// findDirtyFiles returns the source files (and their hashes) among fNames, which are the files of one package, whose
+// generated files are missing or outdated. If force is true all source files are considered dirty
+func findDirtyFiles(fNames []string, force bool) (dirtyFileHashes map[string]string) {
+
+	srcs := readPkgSrcs(fNames)
+	srcHashes := getSrcHashes(srcs)
+
+	dirtyFileHashes = map[string]string{}
+	for fName, src := range srcs {
+
+		srcHash := srcHashes[fName]
+		genFName := getCogoFileName(fName)
+		if !force && isGenFileCurrent(genFName, srcHash, mayHaveCoroutines(src)) {
+			continue
+		}
+
+		dirtyFileHashes[fName] = srcHash
+	}
+
+	return dirtyFileHashes
+}
+
+// isGenFileCurrent returns true if genFName was generated from a source file with srcHash, or if
+// it doesn't exist and doesn't need to
+func isGenFileCurrent(genFName, srcHash string, srcMayHaveCoroutines bool) bool {
+
+	genSrcHash, exists := readGenFileHash(genFName)
+	if !exists {
+		return !srcMayHaveCoroutines
+	}
+
+	return genSrcHash == srcHash
+}
+
+// readGenFileHash returns the source hash stored in the header of a generated file
+func readGenFileHash(genFName string) (srcHash string, exists bool) {
+
+	f, err := os.Open(genFName)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+
+		line := scanner.Text()
+		if strings.HasPrefix(line, genFileHashPrefix) {
+			return strings.TrimPrefix(line, genFileHashPrefix), true
+		}
+
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+
+	return "", true
+}
+
+// isGenFileFromCogo returns true if fName exists and was written by cogo
+func isGenFileFromCogo(fName string) bool {
+
+	f, err := os.Open(fName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(genFileHeaderLine))
+	_, err = io.ReadFull(f, header)
+	return err == nil && string(header) == genFileHeaderLine
+}
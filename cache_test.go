@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDirtyFiles(t *testing.T) {
+
+	dir := copyTestPkg(t, "cache")
+	if !genTestPkg(t, dir) {
+		t.Fatalf("expected the package to generate valid code")
+	}
+
+	fNames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c.go only uses coroutines, so it isn't dirty even though it has no generated file
+	dirtyFileHashes := findDirtyFiles(fNames, false)
+	if len(dirtyFileHashes) != 0 {
+		t.Fatalf("expected no dirty files after generating, but got %v", dirtyFileHashes)
+	}
+
+	// Making 'wait' a yield macro changes the code generated for a.go, even though a.go itself didn't change
+	bFName := filepath.Join(dir, "b.go")
+	bSrc, err := os.ReadFile(bFName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, bFName, strings.Replace(string(bSrc), "func wait", "//cogo:yield\nfunc wait", 1))
+	dirtyFileHashes = findDirtyFiles(fNames, false)
+	if _, ok := dirtyFileHashes[filepath.Join(dir, "a.go")]; !ok {
+		t.Fatalf("expected a.go to be dirty after changing b.go, but got %v", dirtyFileHashes)
+	}
+
+	if !genTestPkg(t, dir) {
+		t.Fatalf("expected the package to generate valid code")
+	}
+
+	genSrc, err := os.ReadFile(filepath.Join(dir, "a.cogo.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(genSrc), "wait(2))") {
+		t.Fatalf("expected 'wait(2)' to be a yield after regenerating, but got:\n%s", genSrc)
+	}
+}
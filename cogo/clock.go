@@ -0,0 +1,80 @@
+package cogo
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time for coroutines and time based yielders. Using a FakeClock
+// lets tests (or paused games) control how time passes
+type Clock interface {
+	Now() time.Time
+}
+
+var _ Clock = realClock{}
+var _ Clock = &FakeClock{}
+
+// RealClock is the wall clock, and is what's used when no clock is set
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a clock that only moves when told to. It's safe for concurrent use
+type FakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{
+		now: start,
+	}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d
+func (f *FakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	f.now = f.now.Add(d)
+	f.lock.Unlock()
+}
+
+// Set moves the clock to t
+func (f *FakeClock) Set(t time.Time) {
+	f.lock.Lock()
+	f.now = t
+	f.lock.Unlock()
+}
+
+// clockTimer finds the delta time between ticks using a clock
+type clockTimer struct {
+	lastTime    time.Time
+	hasLastTime bool
+}
+
+// nextTick returns the info of a tick happening now. The first tick has no delta since nothing ran before it
+func (t *clockTimer) nextTick(clock Clock, lastFrame uint64) TickInfo {
+
+	now := clock.Now()
+	if !t.hasLastTime {
+		t.lastTime = now
+		t.hasLastTime = true
+	}
+
+	info := TickInfo{
+		Delta: now.Sub(t.lastTime),
+		Frame: lastFrame + 1,
+	}
+
+	t.lastTime = now
+	return info
+}
@@ -0,0 +1,49 @@
+package cogo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSleeperWithClock(t *testing.T) {
+
+	clock := NewFakeClock(time.Time{})
+	s := NewSleeperWithClock(time.Second, clock)
+	if s.Tick() {
+		t.Fatalf("expected sleeper to sleep while the clock doesn't move")
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	if s.Tick() {
+		t.Fatalf("expected sleeper to sleep before a second passed on the clock")
+	}
+
+	clock.Set(clock.Now().Add(time.Millisecond))
+	if !s.Tick() {
+		t.Fatalf("expected sleeper to be done once a second passed on the clock")
+	}
+}
+
+func TestCoroutineClock(t *testing.T) {
+
+	recorder := &infoRecorder{}
+	c := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, recorder)
+	}, 0)
+
+	clock := NewFakeClock(time.Time{})
+	c.Clock = clock
+
+	// The first tick has no delta, since nothing ran before it
+	c.Tick()
+	clock.Advance(10 * time.Millisecond)
+	c.Tick()
+	clock.Advance(30 * time.Millisecond)
+	c.Tick()
+
+	expected := []TickInfo{{Frame: 1}, {Delta: 10 * time.Millisecond, Frame: 2}, {Delta: 30 * time.Millisecond, Frame: 3}}
+	if !reflect.DeepEqual(recorder.infos, expected) {
+		t.Fatalf("expected the yielder to get the infos %v, but got %v", expected, recorder.infos)
+	}
+}
@@ -1,51 +1,495 @@
 package cogo
 
-import "fmt"
+import (
+	"fmt"
+	"runtime/debug"
+)
 
 type CoroutineFunc[InT, OutT any] func(c *Coroutine[InT, OutT])
 
-var _ Yielder = &Coroutine[int, int]{}
+var _ DeltaYielder = &Coroutine[int, int]{}
+var _ Canceler = &Coroutine[int, int]{}
+var _ Failer = &Coroutine[int, int]{}
 
+// Coroutine runs a function generated by cogo one piece at a time, between yields.
+//
+// Where the coroutine is suspended is kept private so it can only be changed by the coroutine itself (through
+// the code generated for its yields), and can be read with Status, State and Where.
+//
+// If its Clock field is set, every Tick passes the time passed on the clock to the yielders of the coroutine, like TickDelta does
 type Coroutine[InT, OutT any] struct {
-	State    int32
-	SubState int32
-	In       InT
-	Out      OutT
-	Func     CoroutineFunc[InT, OutT]
-	Yielder  Yielder
+	In   InT
+	Out  OutT
+	Func CoroutineFunc[InT, OutT]
+	ticker
+	// RecoverPanics makes Tick recover panics of the coroutine (and of the yielders it ticks), which then fails
+	// with a *PanicError instead of the panic unwinding through the caller of Tick
+	RecoverPanics bool
+	// Loop makes the coroutine start over on the next tick whenever its function returns, instead of being done.
+	// Every run ends like it would without Loop, so children are cancelled and OnDone functions are called.
+	// Failing or being cancelled still makes the coroutine done
+	Loop bool
+
+	// state is the yield the coroutine is suspended at, with 0 being the start and -1 being done
+	state   int32
+	yielder Yielder
+	// isRunning is set while the coroutine is being ticked
+	isRunning   bool
+	isCancelled bool
+	// catchesErrors is set while the coroutine is suspended at a yield that evaluates to an error, see SuspendErr
+	catchesErrors bool
+
+	// group holds the children started with Go
+	group *Group
+	// onDone holds the functions registered with OnDone, which run once isFinished is set
+	onDone     []func()
+	isFinished bool
+	// resumeErr is the error the coroutine is resumed with, see ResumeErr
+	resumeErr error
 }
 
 func (c *Coroutine[InT, OutT]) Begin() {
 }
 
 func (c *Coroutine[InT, OutT]) Tick() (done bool) {
+	return c.tick(c.nextTick())
+}
+
+// TickDelta is like Tick, but passes info to the yielders of the coroutine (and to nested coroutines),
+// which lets time based yielders like Sleeper run on game time instead of wall clock time
+func (c *Coroutine[InT, OutT]) TickDelta(info TickInfo) (done bool) {
+	return c.tick(c.deltaTick(info))
+}
+
+// IsWaiting returns true if the coroutine is suspended on a yielder given to YieldTo
+func (c *Coroutine[InT, OutT]) IsWaiting() bool {
+	return c.yielder != nil
+}
+
+// State returns the yield the coroutine is suspended at, which is 0 before it started and -1 once it's done
+func (c *Coroutine[InT, OutT]) State() int32 {
+	return c.state
+}
+
+// Yielder returns the yielder the coroutine is waiting on, if any
+func (c *Coroutine[InT, OutT]) Yielder() Yielder {
+	return c.yielder
+}
+
+// Status returns what the coroutine is currently doing
+func (c *Coroutine[InT, OutT]) Status() Status {
+
+	switch {
+	case c.isRunning:
+		return StatusRunning
+	case c.state == -1 && c.err != nil:
+		return StatusFailed
+	case c.state == -1 && c.isCancelled:
+		return StatusCancelled
+	case c.state == -1:
+		return StatusDone
+	case c.yielder != nil:
+		return StatusWaitingOnYielder
+	case c.state == 0:
+		return StatusCreated
+	}
+
+	return StatusSuspended
+}
+
+// Suspend marks the coroutine as suspended at state, so that the next tick resumes it there.
+// It's called by the code generated for yields, so it can only be called by the coroutine while it's running
+func (c *Coroutine[InT, OutT]) Suspend(state int32) {
+
+	if !c.isRunning {
+		c.panicNotRunning("Suspend")
+	}
+
+	c.state = state
+	c.catchesErrors = false
+}
+
+// SuspendTo is like Suspend, but the coroutine also waits for y before resuming, like with YieldTo
+func (c *Coroutine[InT, OutT]) SuspendTo(state int32, y Yielder) {
+
+	if !c.isRunning {
+		c.panicNotRunning("SuspendTo")
+	}
+
+	c.state = state
+	c.yielder = y
+	c.catchesErrors = false
+}
+
+// SuspendErr is like Suspend, but the coroutine handles errors where it's suspended, like with YieldErr.
+// An error passed to Throw is then given to the coroutine through ResumeErr instead of failing it
+func (c *Coroutine[InT, OutT]) SuspendErr(state int32) {
+
+	if !c.isRunning {
+		c.panicNotRunning("SuspendErr")
+	}
+
+	c.state = state
+	c.catchesErrors = true
+}
+
+// SuspendToErr is like SuspendTo, but the coroutine handles the error of y (and errors passed to Throw) itself, like with YieldToErr
+func (c *Coroutine[InT, OutT]) SuspendToErr(state int32, y Yielder) {
+
+	if !c.isRunning {
+		c.panicNotRunning("SuspendToErr")
+	}
+
+	c.state = state
+	c.yielder = y
+	c.catchesErrors = true
+}
+
+// MarkDone marks the coroutine as done. It's called by the code generated for returns, so it can only be called
+// by the coroutine while it's running
+func (c *Coroutine[InT, OutT]) MarkDone() {
+
+	if !c.isRunning {
+		c.panicNotRunning("MarkDone")
+	}
+
+	c.state = -1
+	c.catchesErrors = false
+}
+
+func (c *Coroutine[InT, OutT]) panicNotRunning(funcName string) {
+	panic(fmt.Sprintf("cogo: %s can only be called by a coroutine while it's running, but the coroutine is %s at %s", funcName, c.Status(), c.Where()))
+}
+
+func (c *Coroutine[InT, OutT]) tick(info TickInfo, hasInfo bool) (done bool) {
+
+	if c.isRunning {
+		panic(fmt.Sprintf("cogo: coroutine was ticked while it's already running (resumed from %s). A coroutine can't be ticked by itself or by its yielders", c.Where()))
+	}
+
+	// Deferred so that a panic recovered by the caller (or by a parent with RecoverPanics) doesn't leave it running
+	c.isRunning = true
+	defer func() {
+		c.isRunning = false
+	}()
+
+	if c.RecoverPanics {
+		return c.tickRecover(info, hasInfo)
+	}
+
+	return c.resume(info, hasInfo)
+}
+
+func (c *Coroutine[InT, OutT]) tickRecover(info TickInfo, hasInfo bool) (done bool) {
+
+	defer func() {
+
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		c.failWithPanic(r)
+		done = true
+	}()
+
+	return c.resume(info, hasInfo)
+}
+
+// failWithPanic fails the coroutine with a *PanicError holding the panic value r. The coroutine might already be done,
+// like when an OnDone function panics, in which case the error is only kept if there is none yet. Either way the OnDone
+// functions that didn't run yet are called, and their panics are handled the same way
+func (c *Coroutine[InT, OutT]) failWithPanic(r interface{}) {
+
+	// Where is found before cancelling, since that marks the coroutine as done
+	panicErr := &PanicError{
+		Value: r,
+		Where: c.Where(),
+		Stack: debug.Stack(),
+	}
+
+	if c.err == nil {
+		c.err = panicErr
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.failWithPanic(r)
+		}
+	}()
+
+	// Every OnDone function is removed before it's called, so calling endRun again continues with the ones left
+	switch {
+	case c.state != -1:
+		c.Cancel()
+	case !c.isFinished:
+		c.finish()
+	default:
+		c.endRun()
+	}
+}
+
+func (c *Coroutine[InT, OutT]) resume(info TickInfo, hasInfo bool) (done bool) {
+
+	if c.state == -1 {
+		return true
+	}
+
+	if err := c.ctxErr(); err != nil {
+		c.Fail(err)
+		return true
+	}
+
+	// Children run alongside the coroutine, unless it's already ticking them by waiting on its group
+	if c.group != nil && c.yielder != c.group {
+		c.group.tick(info, hasInfo)
+	}
 
-	if c.State == -1 {
+	if c.failIfGroupFailed() {
 		return true
 	}
 
-	if c.Yielder != nil {
-		if !c.Yielder.Tick() {
+	if c.yielder != nil {
+
+		y := c.yielder
+		if !tickYielder(y, info, hasInfo) {
 			return false
 		}
 
-		c.Yielder = nil
+		c.yielder = nil
+		if c.failIfYielderFailed(y) || c.failIfGroupFailed() {
+			return true
+		}
 	}
 
-	oldYielder := c.Yielder
+	oldYielder := c.yielder
 	c.Func(c)
+	c.resumeErr = nil
+
+	// The coroutine stopped itself with Fail or Cancel, so whatever it did after that doesn't count
+	if c.isFinished {
+		c.state = -1
+		if c.yielder != nil {
+			cancelYielder(c.yielder)
+			c.yielder = nil
+		}
+
+		return true
+	}
 
 	// On YieldTo() we want to always tick once before returning, so here we check do that.
-	// Also, if the yielder was done after one tick we nil it
-	if c.Yielder != oldYielder {
-		if c.Yielder.Tick() {
-			c.Yielder = nil
-		} else {
+	// Also, if the yielder was done after one tick we nil it.
+	//
+	// The new yielder didn't exist for the time that passed before this tick, so it gets no delta
+	if c.yielder != oldYielder {
+
+		y := c.yielder
+		if !tickYielder(y, TickInfo{Frame: info.Frame}, hasInfo) {
+			return false
+		}
+
+		c.yielder = nil
+		if c.failIfYielderFailed(y) {
+			return true
+		}
+	}
+
+	if c.failIfGroupFailed() {
+		return true
+	}
+
+	if c.state == -1 {
+
+		if c.Loop {
+			c.endRun()
+			c.state = 0
 			return false
 		}
+
+		c.finish()
+		return true
 	}
 
-	return c.State == -1
+	return false
+}
+
+// failIfYielderFailed stops the coroutine with the error of y if y failed, so that errors of
+// child coroutines propagate through YieldTo
+func (c *Coroutine[InT, OutT]) failIfYielderFailed(y Yielder) bool {
+
+	f, ok := y.(Failer)
+	if !ok {
+		return false
+	}
+
+	err := f.Err()
+	if err == nil {
+		return false
+	}
+
+	// 'err := c.YieldToErr(y)' handles the error itself
+	if c.catchesErrors {
+		c.resumeErr = err
+		return false
+	}
+
+	c.Fail(err)
+	return true
+}
+
+// Throw resumes the coroutine with err. If the coroutine is suspended at 'err := c.YieldErr(x)' or 'err := c.YieldToErr(y)'
+// the yield evaluates to err (and the yielder of YieldToErr is cancelled), so the coroutine can handle the error where it's
+// suspended. Otherwise the coroutine can't handle err and fails with it.
+//
+// Like Tick, it returns true if the coroutine is done
+func (c *Coroutine[InT, OutT]) Throw(err error) (done bool) {
+
+	if c.state == -1 {
+		return true
+	}
+
+	if !c.catchesErrors {
+		c.Fail(err)
+		return true
+	}
+
+	if c.yielder != nil {
+		cancelYielder(c.yielder)
+		c.yielder = nil
+	}
+
+	c.resumeErr = err
+	return c.Tick()
+}
+
+// ResumeErr returns the error the coroutine was resumed with by Throw, or the error of the yielder of a YieldToErr.
+// Code generated for 'err := c.YieldErr(x)' and 'err := c.YieldToErr(y)' uses it after resuming
+func (c *Coroutine[InT, OutT]) ResumeErr() error {
+	return c.resumeErr
+}
+
+// failIfGroupFailed stops the coroutine with the error of its group if a child failed
+func (c *Coroutine[InT, OutT]) failIfGroupFailed() bool {
+
+	if c.group == nil || c.group.err == nil {
+		return false
+	}
+
+	c.Fail(c.group.err)
+	return true
+}
+
+// finish marks the coroutine as done, and ends its current run
+func (c *Coroutine[InT, OutT]) finish() {
+
+	if c.isFinished {
+		return
+	}
+
+	c.isFinished = true
+	c.endRun()
+}
+
+// endRun cancels the children that are still running and runs the OnDone functions, which happens
+// at the end of every run of the coroutine function
+func (c *Coroutine[InT, OutT]) endRun() {
+
+	if c.group != nil {
+		c.group.Cancel()
+	}
+
+	// The slice is kept so that looping or reset coroutines don't allocate it again
+	for len(c.onDone) > 0 {
+
+		last := len(c.onDone) - 1
+		f := c.onDone[last]
+		c.onDone[last] = nil
+		c.onDone = c.onDone[:last]
+		f()
+	}
+}
+
+// OnDone registers f to be called once the coroutine is done, whether it finished, failed or was cancelled.
+// Like deferred calls, the functions are called in the reverse order they were registered in, and after
+// the children of the coroutine are cancelled. If the coroutine is already done f is called right away.
+//
+// 'defer' statements inside coroutines are turned into OnDone calls by cogo, since a coroutine function
+// returns on every yield
+func (c *Coroutine[InT, OutT]) OnDone(f func()) {
+
+	if c.isFinished {
+		f()
+		return
+	}
+
+	c.onDone = append(c.onDone, f)
+}
+
+// Cancel stops the coroutine where it's suspended, so that it's done and never resumed. The yielder it's waiting
+// on (if it's a Canceler) and the children started with Go are cancelled as well
+func (c *Coroutine[InT, OutT]) Cancel() {
+
+	if c.state == -1 {
+		return
+	}
+
+	c.state = -1
+	c.isCancelled = true
+	if c.yielder != nil {
+		cancelYielder(c.yielder)
+		c.yielder = nil
+	}
+
+	c.finish()
+}
+
+// Fail stops the coroutine with err as its error, like Cancel does. Inside the coroutine it should be followed by a return,
+// since anything it does after failing is ignored. Failing a coroutine that is already done does nothing
+func (c *Coroutine[InT, OutT]) Fail(err error) {
+
+	if c.state == -1 {
+		return
+	}
+
+	c.err = err
+	c.Cancel()
+}
+
+// Err returns the error the coroutine failed with. Besides Fail, a coroutine fails with the error of a yielder it was
+// waiting on with YieldTo (like a child coroutine), of the first child started with Go that failed, of its context,
+// or with a *PanicError if RecoverPanics is set
+func (c *Coroutine[InT, OutT]) Err() error {
+	return c.err
+}
+
+// Go starts the child y, which is ticked every time the coroutine is ticked (before the coroutine itself),
+// until either the child is done, or the coroutine is done, at which point the child is cancelled.
+//
+// If a child fails, the other children are cancelled and the coroutine fails with the same error. To wait for all
+// children use 'c.YieldTo(c.Group())'
+func (c *Coroutine[InT, OutT]) Go(y Yielder) {
+	c.Group().Go(y)
+}
+
+// Group returns the group holding the children of the coroutine
+func (c *Coroutine[InT, OutT]) Group() *Group {
+
+	if c.group == nil {
+		c.group = NewGroup()
+	}
+
+	return c.group
+}
+
+func tickYielder(y Yielder, info TickInfo, hasInfo bool) (done bool) {
+
+	if hasInfo {
+		if dy, ok := y.(DeltaYielder); ok {
+			return dy.TickDelta(info)
+		}
+	}
+
+	return y.Tick()
 }
 
 // Yield yields and sets the Out variable to the passed variable
@@ -66,12 +510,108 @@ func (c *Coroutine[InT, OutT]) YieldNone() {
 	panic(fmt.Sprintf("YieldNone got called at runtime, which means the code generator was not run, you used cogo incorrectly, or cogo has a bug. Yield should NOT get called at runtime. coroutine: %+v;;;", c))
 }
 
+// YieldRecv yields like Yield, and once the coroutine is resumed evaluates to its new input. This lets the coroutine
+// receive a value on every resume, for example with 'input := c.YieldRecv(out)' and Resume
+func (c *Coroutine[InT, OutT]) YieldRecv(out OutT) (in InT) {
+	panic(fmt.Sprintf("YieldRecv got called at runtime, which means the code generator was not run, you used cogo incorrectly, or cogo has a bug. YieldRecv should NOT get called at runtime. coroutine: %+v;;; yield value: %+v;;;", c, out))
+}
+
+// YieldErr yields like Yield, and once the coroutine is resumed evaluates to the error passed to Throw, or nil if it was resumed
+// normally. This lets the coroutine handle errors where it's suspended, for example with 'if err := c.YieldErr(out); err != nil {'
+func (c *Coroutine[InT, OutT]) YieldErr(out OutT) error {
+	panic(fmt.Sprintf("YieldErr got called at runtime, which means the code generator was not run, you used cogo incorrectly, or cogo has a bug. YieldErr should NOT get called at runtime. coroutine: %+v;;; yield value: %+v;;;", c, out))
+}
+
+// YieldToErr is like YieldTo, but once the coroutine resumes evaluates to the error of the yielder (if it's a Failer)
+// or the error passed to Throw, instead of the coroutine failing with it
+func (c *Coroutine[InT, OutT]) YieldToErr(y Yielder) error {
+	panic(fmt.Sprintf("YieldToErr got called at runtime, which means the code generator was not run, you used cogo incorrectly, or cogo has a bug. YieldToErr should NOT get called at runtime. coroutine: %+v;;; yielder value: %+v;;;", c, y))
+}
+
+// Resume sets the input of the coroutine to in and ticks it. It returns the output of
+// the coroutine, and whether it's done
+func (c *Coroutine[InT, OutT]) Resume(in InT) (out OutT, done bool) {
+	c.In = in
+	done = c.Tick()
+	return c.Out, done
+}
+
+// StateInfo returns where the coroutine is currently suspended
+func (c *Coroutine[InT, OutT]) StateInfo() (info StateInfo, ok bool) {
+	return LookupState(c.Func, c.state)
+}
+
+// Where returns a description of where the coroutine is suspended, like 'patrol.go:42'.
+// If the state isn't registered we fall back to 'State=3'
+func (c *Coroutine[InT, OutT]) Where() string {
+
+	switch c.state {
+	case 0:
+		return "start"
+	case -1:
+		return "done"
+	}
+
+	info, ok := c.StateInfo()
+	if !ok {
+		return fmt.Sprintf("State=%d", c.state)
+	}
+
+	return info.String()
+}
+
 func HasGen() bool {
 	return true
 }
 
 func New[InT, OutT any](coro CoroutineFunc[InT, OutT], input InT) (c *Coroutine[InT, OutT]) {
-	return &Coroutine[InT, OutT]{
+	c = &Coroutine[InT, OutT]{}
+	c.Init(coro, input)
+	return c
+}
+
+// Reset restarts the coroutine from the beginning with in as its input, without allocating a new one. If the coroutine
+// isn't done its current run is ended first, so the yielder it's waiting on and its children are cancelled, and its OnDone
+// functions are called. Its settings (Func, Clock, RecoverPanics, Loop and the context) are kept
+func (c *Coroutine[InT, OutT]) Reset(in InT) {
+
+	if c.isRunning {
+		panic(fmt.Sprintf("cogo: Reset can't be called while the coroutine is running (resumed from %s)", c.Where()))
+	}
+
+	if !c.isFinished {
+
+		if c.yielder != nil {
+			cancelYielder(c.yielder)
+		}
+
+		c.endRun()
+	}
+
+	// The group and the OnDone slice are kept to avoid allocating them again
+	if c.group != nil {
+		c.group.err = nil
+	}
+
+	*c = Coroutine[InT, OutT]{
+		In:   in,
+		Func: c.Func,
+		ticker: ticker{
+			Clock:   c.Clock,
+			ctx:     c.ctx,
+			ctxDone: c.ctxDone,
+		},
+		RecoverPanics: c.RecoverPanics,
+		Loop:          c.Loop,
+		group:         c.group,
+		onDone:        c.onDone,
+	}
+}
+
+// Init (re)starts c as a new coroutine running coro. This allows embedding coroutines by value in other structs
+// and reusing them, which avoids the allocation done by New
+func (c *Coroutine[InT, OutT]) Init(coro CoroutineFunc[InT, OutT], input InT) {
+	*c = Coroutine[InT, OutT]{
 		Func: coro,
 		In:   input,
 	}
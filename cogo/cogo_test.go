@@ -0,0 +1,342 @@
+package cogo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCoroutineOnDone(t *testing.T) {
+
+	var calls []string
+	finished := New(func(c *Coroutine[int, int]) {
+		c.OnDone(func() { calls = append(calls, "first") })
+		c.OnDone(func() { calls = append(calls, "second") })
+		c.MarkDone()
+	}, 0)
+
+	finished.Tick()
+	if !reflect.DeepEqual(calls, []string{"second", "first"}) {
+		t.Fatalf("expected OnDone functions to run in reverse order once, but got %v", calls)
+	}
+
+	calls = nil
+	cancelled := New(func(c *Coroutine[int, int]) {
+		c.OnDone(func() { calls = append(calls, "cancelled") })
+		c.Suspend(1)
+	}, 0)
+
+	cancelled.Tick()
+	if len(calls) != 0 {
+		t.Fatalf("expected OnDone functions to not run while the coroutine is suspended")
+	}
+
+	cancelled.Cancel()
+	cancelled.Cancel()
+	if !reflect.DeepEqual(calls, []string{"cancelled"}) {
+		t.Fatalf("expected OnDone functions to run once on cancel, but got %v", calls)
+	}
+}
+
+func TestCoroutineRecoverPanics(t *testing.T) {
+
+	errBoom := errors.New("boom")
+	c := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.Suspend(1)
+			return
+		}
+
+		panic(errBoom)
+	}, 0)
+
+	c.RecoverPanics = true
+	c.Tick()
+	if !c.Tick() {
+		t.Fatalf("expected coroutine to be done after panicking")
+	}
+
+	var panicErr *PanicError
+	if !errors.As(c.Err(), &panicErr) || panicErr.Where != "State=1" || !errors.Is(c.Err(), errBoom) {
+		t.Fatalf("expected a panic error at 'State=1' wrapping the panic value, but got '%v'", c.Err())
+	}
+}
+
+func TestCoroutineRecoverPanicsWhenDone(t *testing.T) {
+
+	var calls []string
+	c := New(func(c *Coroutine[int, int]) {
+		c.OnDone(func() { calls = append(calls, "first") })
+		c.OnDone(func() { panic("on done") })
+		c.OnDone(func() { calls = append(calls, "last") })
+		c.MarkDone()
+	}, 0)
+
+	c.RecoverPanics = true
+	var panicErr *PanicError
+	if !c.Tick() || !errors.As(c.Err(), &panicErr) || panicErr.Value != "on done" || c.Status() != StatusFailed {
+		t.Fatalf("expected a panic in an OnDone function to fail the coroutine, but got status '%s' and error '%v'", c.Status(), c.Err())
+	}
+
+	if !reflect.DeepEqual(calls, []string{"last", "first"}) {
+		t.Fatalf("expected the OnDone functions after the panic to still run, but got %v", calls)
+	}
+
+	// A child whose cancel panics once the parent is done
+	child := New(func(c *Coroutine[int, int]) {
+		c.OnDone(func() { panic("child cancelled") })
+		c.Suspend(1)
+	}, 0)
+
+	calls = nil
+	parent := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.OnDone(func() { calls = append(calls, "parent") })
+			c.Go(child)
+			c.Suspend(1)
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	parent.RecoverPanics = true
+	parent.Tick()
+	if !parent.Tick() || !errors.As(parent.Err(), &panicErr) || panicErr.Value != "child cancelled" {
+		t.Fatalf("expected a panic while cancelling a child to fail the parent, but got '%v'", parent.Err())
+	}
+
+	if !reflect.DeepEqual(calls, []string{"parent"}) {
+		t.Fatalf("expected the OnDone functions of the parent to run, but got %v", calls)
+	}
+}
+
+func TestCoroutineFailPropagatesThroughYieldTo(t *testing.T) {
+
+	errChild := errors.New("child failed")
+	child := New(func(c *Coroutine[int, int]) {
+
+		c.Fail(errChild)
+
+		// Yielding after failing is ignored
+		c.Suspend(1)
+	}, 0)
+
+	parent := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, child)
+	}, 0)
+
+	if !parent.Tick() || parent.Err() != errChild || child.Err() != errChild {
+		t.Fatalf("expected child error to fail the parent, but got '%v'", parent.Err())
+	}
+}
+
+// throwTarget is a hand written coroutine that handles errors thrown into it at state 1, like 'err := c.YieldErr(1)' would
+func throwTarget(c *Coroutine[int, int]) {
+
+	switch c.State() {
+	case 0:
+		c.SuspendErr(1)
+		return
+	case 1:
+		if c.ResumeErr() != nil {
+			c.Out = -1
+		}
+
+		c.Suspend(2)
+		return
+	}
+
+	c.MarkDone()
+}
+
+func TestCoroutineThrow(t *testing.T) {
+
+	errThrown := errors.New("thrown")
+	c := New(throwTarget, 0)
+	c.Tick()
+
+	if c.Throw(errThrown) || c.Out != -1 || c.Err() != nil {
+		t.Fatalf("expected the error to be handled at the YieldErr, but got out %d and error '%v'", c.Out, c.Err())
+	}
+
+	if !c.Throw(errThrown) || c.Err() != errThrown {
+		t.Fatalf("expected the coroutine to fail with an error thrown at a Yield, but got '%v'", c.Err())
+	}
+
+	// Whether errors are handled doesn't depend on the function, so wrappers catch them too
+	c = New(func(c *Coroutine[int, int]) { throwTarget(c) }, 0)
+	c.Tick()
+	if c.Throw(errThrown) || c.Out != -1 {
+		t.Fatalf("expected a wrapped coroutine to handle the error at the YieldErr, but got error '%v'", c.Err())
+	}
+}
+
+func TestCoroutineSuspendToErr(t *testing.T) {
+
+	errChild := errors.New("child failed")
+	child := New(func(c *Coroutine[int, int]) {
+		c.Fail(errChild)
+	}, 0)
+
+	var resumeErr error
+	parent := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.SuspendToErr(1, child)
+			return
+		}
+
+		resumeErr = c.ResumeErr()
+		c.MarkDone()
+	}, 0)
+
+	// The child fails on the tick it's yielded to on, and the parent resumes with its error on the next one
+	parent.Tick()
+	if !parent.Tick() || parent.Err() != nil || resumeErr != errChild {
+		t.Fatalf("expected the parent to handle the child error at the YieldToErr, but got '%v' and '%v'", resumeErr, parent.Err())
+	}
+}
+
+func TestCoroutineStatus(t *testing.T) {
+
+	var statusWhileRunning Status
+	c := New(func(c *Coroutine[int, int]) {
+
+		statusWhileRunning = c.Status()
+		if c.State() == 0 {
+			c.SuspendTo(1, NewFrameWaiter(1))
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	expected := []Status{StatusCreated, StatusWaitingOnYielder, StatusDone}
+	for i, status := range expected {
+
+		if c.Status() != status {
+			t.Fatalf("expected status '%s' after %d ticks, but got '%s'", status, i, c.Status())
+		}
+
+		c.Tick()
+	}
+
+	if statusWhileRunning != StatusRunning {
+		t.Fatalf("expected status '%s' while running, but got '%s'", StatusRunning, statusWhileRunning)
+	}
+}
+
+func TestCoroutineReentrantTick(t *testing.T) {
+
+	c := New(func(c *Coroutine[int, int]) {
+		c.Tick()
+	}, 0)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected ticking a running coroutine to panic")
+		}
+	}()
+
+	c.Tick()
+}
+
+func TestCoroutineNotRunningAfterPanic(t *testing.T) {
+
+	c := New(func(c *Coroutine[int, int]) {
+		panic("boom")
+	}, 0)
+
+	func() {
+		defer func() { recover() }()
+		c.Tick()
+	}()
+
+	if c.Status() == StatusRunning {
+		t.Fatalf("expected coroutine to not be running after a panic recovered by the caller")
+	}
+
+	// A child that panics while being waited on by a parent that recovers panics
+	child := New(func(c *Coroutine[int, int]) {
+		panic("boom")
+	}, 0)
+
+	parent := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, child)
+	}, 0)
+
+	parent.RecoverPanics = true
+	parent.Tick()
+	if parent.Status() != StatusFailed || child.Status() == StatusRunning {
+		t.Fatalf("expected parent to fail and child to not be running, but got '%s' and '%s'", parent.Status(), child.Status())
+	}
+
+	c.Reset(0)
+	child.Reset(0)
+}
+
+func TestCoroutineReset(t *testing.T) {
+
+	runs := 0
+	waitingOn := &testChild{ticksLeft: 10}
+	c := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			runs++
+			c.Out = c.In
+			c.OnDone(func() { c.Out = -1 })
+			c.SuspendTo(1, waitingOn)
+			return
+		}
+
+		c.MarkDone()
+	}, 1)
+
+	c.Tick()
+	c.Reset(2)
+
+	if !waitingOn.isCancelled || c.Status() != StatusCreated || c.Out != 0 || c.In != 2 {
+		t.Fatalf("expected reset to end the current run and restart the coroutine, but got status '%s' with in %d and out %d", c.Status(), c.In, c.Out)
+	}
+
+	c.Tick()
+	if runs != 2 || c.Out != 2 {
+		t.Fatalf("expected the coroutine to run again with the new input, but got %d runs and out %d", runs, c.Out)
+	}
+}
+
+func TestCoroutineLoop(t *testing.T) {
+
+	runs := 0
+	doneCalls := 0
+	c := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			runs++
+			c.OnDone(func() { doneCalls++ })
+			c.Suspend(1)
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	c.Loop = true
+	for i := 0; i < 6; i++ {
+		if c.Tick() {
+			t.Fatalf("expected a looping coroutine to never be done")
+		}
+	}
+
+	if runs != 3 || doneCalls != 3 {
+		t.Fatalf("expected 3 runs that each called OnDone, but got %d runs and %d OnDone calls", runs, doneCalls)
+	}
+
+	c.Cancel()
+	if !c.Tick() || doneCalls != 3 {
+		t.Fatalf("expected a cancelled looping coroutine to be done")
+	}
+}
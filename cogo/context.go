@@ -0,0 +1,93 @@
+package cogo
+
+import (
+	"context"
+	"time"
+)
+
+var _ Yielder = &ContextWaiter{}
+
+type ContextWaiter struct {
+	done <-chan struct{}
+}
+
+func (w *ContextWaiter) Tick() bool {
+	return isChanClosed(w.done)
+}
+
+// NewContextWaiter returns a yielder that is done once ctx is cancelled or its deadline passes.
+// A context that can never be cancelled (like context.Background()) makes the yielder wait forever
+func NewContextWaiter(ctx context.Context) *ContextWaiter {
+	return &ContextWaiter{
+		done: ctx.Done(),
+	}
+}
+
+// Run ticks y every interval until it's done or ctx is done, in which case y is cancelled if it's a Canceler.
+// Delta yielders (like coroutines and schedulers) are ticked with TickDelta using the wall clock, except for
+// coroutines and schedulers with a Clock, which are ticked with Tick so that they run on their own clock.
+// An interval of zero ticks y again as soon as the previous tick is done.
+//
+// The returned error is ctx.Err() if ctx was done first, otherwise it's the error of y if it's a Failer
+func Run(ctx context.Context, y Yielder, interval time.Duration) error {
+
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	var timer clockTimer
+	var frame uint64
+	for {
+
+		if err := ctx.Err(); err != nil {
+			cancelYielder(y)
+			return err
+		}
+
+		var done bool
+		if ct, ok := y.(clockTicker); ok && ct.hasClock() {
+			done = y.Tick()
+		} else {
+
+			info := timer.nextTick(RealClock, frame)
+			frame = info.Frame
+			done = tickYielder(y, info, true)
+		}
+
+		if done {
+			break
+		}
+
+		if ticker == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	if f, ok := y.(Failer); ok {
+		return f.Err()
+	}
+
+	return nil
+}
+
+// isChanClosed returns true if ch is closed. A nil channel is never closed
+func isChanClosed(ch <-chan struct{}) bool {
+
+	if ch == nil {
+		return false
+	}
+
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
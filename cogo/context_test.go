@@ -0,0 +1,73 @@
+package cogo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCoroutineContextCancel(t *testing.T) {
+
+	waitingOn := &testChild{ticksLeft: 10}
+	c := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, waitingOn)
+	}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.SetContext(ctx)
+
+	if c.Tick() {
+		t.Fatalf("expected coroutine to wait while its context isn't done")
+	}
+
+	cancel()
+	if !c.Tick() || !errors.Is(c.Err(), context.Canceled) || !waitingOn.isCancelled {
+		t.Fatalf("expected coroutine and its yielder to be cancelled with the context error, but got '%v'", c.Err())
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	err := Run(context.Background(), NewFrameWaiter(3), 0)
+	if err != nil {
+		t.Fatalf("expected Run to return no error once the yielder is done, but got '%v'", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	s := NewScheduler()
+	waitingForever := &testChild{ticksLeft: 1 << 30}
+	s.Add(waitingForever)
+
+	err = Run(ctx, s, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !waitingForever.isCancelled {
+		t.Fatalf("expected Run to cancel the scheduler once the deadline passed, but got '%v'", err)
+	}
+}
+
+func TestRunUsesClock(t *testing.T) {
+
+	// An hour passes on the clock during the first tick, which the sleeper only sees if the coroutine runs on the clock
+	clock := NewFakeClock(time.Time{})
+	c := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			clock.Advance(time.Hour)
+			c.SuspendTo(1, NewSleeper(time.Hour))
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	c.Clock = clock
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := Run(ctx, c, time.Millisecond)
+	if err != nil || c.Status() != StatusDone {
+		t.Fatalf("expected Run to tick the coroutine on its clock, but got status '%s' and error '%v'", c.Status(), err)
+	}
+}
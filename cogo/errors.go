@@ -0,0 +1,31 @@
+package cogo
+
+import "fmt"
+
+// PanicError is the error of a coroutine that panicked while RecoverPanics was set. It's also what
+// ParallelScheduler.Tick panics with when a task panicked on one of its workers
+type PanicError struct {
+	// Value is what the coroutine panicked with
+	Value interface{}
+	// Where is where the coroutine was last resumed from before it panicked, like 'patrol.go:42' (see Coroutine.Where).
+	// It's empty for tasks that aren't coroutines
+	Where string
+	// Stack is the stack of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+
+	if e.Where == "" {
+		return fmt.Sprintf("task panicked: %v", e.Value)
+	}
+
+	return fmt.Sprintf("coroutine panicked after resuming from %s: %v", e.Where, e.Value)
+}
+
+// Unwrap returns the panic value if it's an error
+func (e *PanicError) Unwrap() error {
+
+	err, _ := e.Value.(error)
+	return err
+}
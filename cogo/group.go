@@ -0,0 +1,121 @@
+package cogo
+
+var _ DeltaYielder = &Group{}
+var _ Canceler = &Group{}
+var _ Failer = &Group{}
+
+// Canceler is implemented by yielders that can be stopped before they are done, for example to stop
+// a child coroutine once its parent is done
+type Canceler interface {
+	Cancel()
+}
+
+// Failer is implemented by yielders that can finish with an error
+type Failer interface {
+	Err() error
+}
+
+// Group runs many child tasks (coroutines or any other yielders) together, and is done once all of them are done.
+// It's the cooperative equivalent of an errgroup: once a child finishes with an error (see Failer), the other
+// children are cancelled and the group is done with that error.
+//
+// A group is usually owned by a coroutine, where children are started with Coroutine.Go and waited on
+// with 'c.YieldTo(c.Group())', but a group can also be used on its own, like with a Scheduler
+type Group struct {
+	tasks []Yielder
+	err   error
+}
+
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Go adds the child y to the group, which starts being ticked on the next tick of the group.
+// Children are ticked in the order they were added
+func (g *Group) Go(y Yielder) {
+	g.tasks = append(g.tasks, y)
+}
+
+// Tick ticks all children once, and returns true once there are no children left or one of them failed
+func (g *Group) Tick() (done bool) {
+	return g.tick(TickInfo{}, false)
+}
+
+// TickDelta is like Tick, but passes info to the children
+func (g *Group) TickDelta(info TickInfo) (done bool) {
+	return g.tick(info, true)
+}
+
+func (g *Group) tick(info TickInfo, hasInfo bool) (done bool) {
+
+	if g.err != nil {
+		return true
+	}
+
+	// Children added by other children during the tick are after taskCount, and run starting from the next tick
+	taskCount := len(g.tasks)
+	liveCount := 0
+	for i := 0; i < taskCount; i++ {
+
+		y := g.tasks[i]
+		if !tickYielder(y, info, hasInfo) {
+			g.tasks[liveCount] = y
+			liveCount++
+			continue
+		}
+
+		if f, ok := y.(Failer); ok && f.Err() != nil {
+
+			// Keep the children that weren't ticked yet so they get cancelled too
+			liveCount += copy(g.tasks[liveCount:], g.tasks[i+1:])
+			g.tasks = g.tasks[:liveCount]
+
+			g.err = f.Err()
+			g.Cancel()
+			return true
+		}
+	}
+
+	liveCount += copy(g.tasks[liveCount:], g.tasks[taskCount:])
+
+	// Clear the removed tasks so they can be garbage collected
+	for i := liveCount; i < len(g.tasks); i++ {
+		g.tasks[i] = nil
+	}
+
+	g.tasks = g.tasks[:liveCount]
+	return liveCount == 0
+}
+
+// Cancel cancels all children that implement Canceler and removes all children from the group
+func (g *Group) Cancel() {
+
+	// Cancelling a child might add new children (e.g. by a cleanup), so loop until there are none left
+	for len(g.tasks) > 0 {
+
+		tasks := g.tasks
+		g.tasks = nil
+
+		for _, y := range tasks {
+			cancelYielder(y)
+		}
+	}
+}
+
+// Err returns the error of the first child that failed, if any
+func (g *Group) Err() error {
+	return g.err
+}
+
+// Len returns the number of children that aren't done
+func (g *Group) Len() int {
+	return len(g.tasks)
+}
+
+// cancelYielder cancels y if it's a Canceler
+func cancelYielder(y Yielder) {
+
+	if c, ok := y.(Canceler); ok {
+		c.Cancel()
+	}
+}
@@ -0,0 +1,115 @@
+package cogo
+
+import (
+	"errors"
+	"testing"
+)
+
+// testChild is a child task that runs for a number of ticks, then finishes with err
+type testChild struct {
+	ticksLeft   int
+	err         error
+	isCancelled bool
+}
+
+func (c *testChild) Tick() bool {
+	c.ticksLeft--
+	return c.ticksLeft <= 0
+}
+
+func (c *testChild) Cancel() {
+	c.isCancelled = true
+}
+
+func (c *testChild) Err() error {
+
+	if c.ticksLeft > 0 {
+		return nil
+	}
+
+	return c.err
+}
+
+func TestGroupCancelsChildrenWhenParentFinishes(t *testing.T) {
+
+	child := &testChild{ticksLeft: 10}
+
+	// A hand written coroutine that starts a child and finishes on the next tick
+	parent := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.Suspend(1)
+			c.Go(child)
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	parent.Tick()
+	if !parent.Tick() {
+		t.Fatalf("expected parent to be done")
+	}
+
+	if child.ticksLeft != 9 || !child.isCancelled {
+		t.Fatalf("expected child to be ticked once and then cancelled, but got %+v", child)
+	}
+}
+
+func TestGroupErrorPropagatesToParent(t *testing.T) {
+
+	errChild := errors.New("child failed")
+	failing := &testChild{ticksLeft: 2, err: errChild}
+	sibling := &testChild{ticksLeft: 10}
+
+	// A hand written coroutine that starts two children and waits for both
+	parent := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.Go(failing)
+			c.Go(sibling)
+			c.SuspendTo(1, c.Group())
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	if parent.Tick() {
+		t.Fatalf("expected parent to wait for its children")
+	}
+
+	if !parent.Tick() {
+		t.Fatalf("expected parent to be done once a child failed")
+	}
+
+	if parent.Err() != errChild || parent.Group().Err() != errChild {
+		t.Fatalf("expected parent and group to fail with the child error, but got '%v' and '%v'", parent.Err(), parent.Group().Err())
+	}
+
+	if !sibling.isCancelled {
+		t.Fatalf("expected sibling of the failed child to be cancelled")
+	}
+}
+
+func TestCoroutineCancel(t *testing.T) {
+
+	waitingOn := &testChild{ticksLeft: 10}
+	child := &testChild{ticksLeft: 10}
+
+	c := New(func(c *Coroutine[int, int]) {
+		c.Go(child)
+		c.SuspendTo(1, waitingOn)
+	}, 0)
+
+	c.Tick()
+	c.Cancel()
+
+	if !c.Tick() || c.Err() != nil {
+		t.Fatalf("expected cancelled coroutine to be done without an error")
+	}
+
+	if !waitingOn.isCancelled || !child.isCancelled {
+		t.Fatalf("expected the yielder and the children of the coroutine to be cancelled")
+	}
+}
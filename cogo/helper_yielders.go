@@ -1,20 +1,152 @@
 package cogo
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
-var _ Yielder = &Sleeper{}
+var _ DeltaYielder = &Sleeper{}
+var _ Yielder = &ChanReceiver[int]{}
+var _ Yielder = &WaitGroupWaiter{}
+var _ Yielder = &FrameWaiter{}
+var _ Yielder = &ConditionWaiter{}
 
 type Sleeper struct {
-	wakeupTime time.Time
+	duration time.Duration
+	elapsed  time.Duration
+	clock    Clock
+	// lastTime is used to find the elapsed time when ticked without a delta
+	lastTime time.Time
 }
 
+// Tick adds the time passed on the clock of the sleeper since the last tick to the elapsed time
 func (s *Sleeper) Tick() bool {
-	return !time.Now().Before(s.wakeupTime)
+
+	now := s.clock.Now()
+	s.elapsed += now.Sub(s.lastTime)
+	s.lastTime = now
+	return s.elapsed >= s.duration
+}
+
+// TickDelta adds the delta of the tick to the elapsed time. A sleeper should either be ticked with Tick or TickDelta, not both
+func (s *Sleeper) TickDelta(info TickInfo) bool {
+	s.elapsed += info.Delta
+	return s.elapsed >= s.duration
 }
 
 // NewSleeper returns a sleeper that is done after at least sleepDuration time has passed
 func NewSleeper(sleepDuration time.Duration) *Sleeper {
-	return &Sleeper{
-		wakeupTime: time.Now().Add(sleepDuration),
+	return NewSleeperWithClock(sleepDuration, RealClock)
+}
+
+// NewSleeperWithClock is like NewSleeper, but the time is measured with clock when the sleeper is ticked without a delta
+func NewSleeperWithClock(sleepDuration time.Duration, clock Clock) *Sleeper {
+	return (&Sleeper{clock: clock}).Reset(sleepDuration)
+}
+
+// Reset makes the sleeper wait for sleepDuration again and returns it, so a sleeper can be reused without allocating,
+// like 'c.YieldTo(e.sleeper.Reset(time.Second))'
+func (s *Sleeper) Reset(sleepDuration time.Duration) *Sleeper {
+
+	if s.clock == nil {
+		s.clock = RealClock
+	}
+
+	s.duration = sleepDuration
+	s.elapsed = 0
+	s.lastTime = s.clock.Now()
+	return s
+}
+
+type ChanReceiver[T any] struct {
+	ch <-chan T
+}
+
+func (r *ChanReceiver[T]) Tick() bool {
+
+	select {
+	case <-r.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewChanReceiver returns a yielder that is done once a value is received from ch or ch is closed.
+// The received value is discarded, which makes it the cooperative equivalent of a bare '<-ch'
+func NewChanReceiver[T any](ch <-chan T) *ChanReceiver[T] {
+	return &ChanReceiver[T]{
+		ch: ch,
+	}
+}
+
+type WaitGroupWaiter struct {
+	done chan struct{}
+}
+
+func (w *WaitGroupWaiter) Tick() bool {
+
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewWaitGroupWaiter returns a yielder that is done once wg.Wait() returns.
+//
+// Since a WaitGroup can't be polled, the wait happens on a separate goroutine which
+// the yielder checks on every tick
+func NewWaitGroupWaiter(wg *sync.WaitGroup) *WaitGroupWaiter {
+
+	w := &WaitGroupWaiter{
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		wg.Wait()
+		close(w.done)
+	}()
+
+	return w
+}
+
+type FrameWaiter struct {
+	framesLeft int
+}
+
+func (f *FrameWaiter) Tick() bool {
+	f.framesLeft--
+	return f.framesLeft < 0
+}
+
+// NewFrameWaiter returns a yielder that is done after 'frames' ticks following the tick it was yielded to on.
+//
+// For example, after 'c.YieldTo(cogo.NewFrameWaiter(1))' the coroutine resumes on the next tick
+func NewFrameWaiter(frames int) *FrameWaiter {
+	return &FrameWaiter{
+		framesLeft: frames,
+	}
+}
+
+// Reset makes the waiter wait for 'frames' ticks again and returns it, so it can be reused without allocating
+func (f *FrameWaiter) Reset(frames int) *FrameWaiter {
+	f.framesLeft = frames
+	return f
+}
+
+type ConditionWaiter struct {
+	cond func() bool
+}
+
+func (w *ConditionWaiter) Tick() bool {
+	return w.cond()
+}
+
+// NewConditionWaiter returns a yielder that is done once cond returns true. cond is called once per tick
+func NewConditionWaiter(cond func() bool) *ConditionWaiter {
+	return &ConditionWaiter{
+		cond: cond,
 	}
 }
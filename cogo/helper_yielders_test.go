@@ -0,0 +1,63 @@
+package cogo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// infoRecorder is a delta yielder that never finishes and records the info of every tick
+type infoRecorder struct {
+	infos []TickInfo
+}
+
+func (r *infoRecorder) Tick() bool {
+	return r.TickDelta(TickInfo{})
+}
+
+func (r *infoRecorder) TickDelta(info TickInfo) bool {
+	r.infos = append(r.infos, info)
+	return false
+}
+
+func TestSleeperTickDelta(t *testing.T) {
+
+	s := NewSleeper(100 * time.Millisecond)
+	if s.TickDelta(TickInfo{Delta: 60 * time.Millisecond}) {
+		t.Fatalf("expected sleeper to sleep before 100ms passed")
+	}
+
+	if !s.TickDelta(TickInfo{Delta: 40 * time.Millisecond}) {
+		t.Fatalf("expected sleeper to be done once 100ms passed")
+	}
+
+	s.Reset(time.Hour)
+	if s.TickDelta(TickInfo{Delta: time.Minute}) {
+		t.Fatalf("expected a reset sleeper to sleep again")
+	}
+}
+
+func TestTickInfoThroughNestedCoroutines(t *testing.T) {
+
+	recorder := &infoRecorder{}
+	child := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, recorder)
+	}, 0)
+
+	parent := New(func(c *Coroutine[int, int]) {
+		c.SuspendTo(1, child)
+	}, 0)
+
+	parent.TickDelta(TickInfo{Delta: 16 * time.Millisecond, Frame: 1})
+	parent.TickDelta(TickInfo{Delta: 20 * time.Millisecond, Frame: 2})
+
+	// Yielders get no delta on the tick they are yielded to on, since they didn't exist before it
+	expected := []TickInfo{{Frame: 1}, {Delta: 20 * time.Millisecond, Frame: 2}}
+	if !reflect.DeepEqual(recorder.infos, expected) {
+		t.Fatalf("expected the nested yielder to get the infos %v, but got %v", expected, recorder.infos)
+	}
+
+	if child.LastTick() != expected[1] {
+		t.Fatalf("expected the child to keep the info of its last tick, but got %v", child.LastTick())
+	}
+}
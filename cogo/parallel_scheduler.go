@@ -0,0 +1,277 @@
+package cogo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+var _ DeltaYielder = &ParallelScheduler{}
+var _ Canceler = &ParallelScheduler{}
+var _ Failer = &ParallelScheduler{}
+
+// ParallelScheduler is like Scheduler, but partitions its tasks into shards that are ticked concurrently,
+// each by its own worker goroutine.
+//
+// The guarantees are:
+//   - A task is placed in one shard when added and stays there, and a shard is only ever ticked by its worker,
+//     so a task is never ticked from two goroutines at once, and is ticked at most once per tick
+//   - Tick returns only after every shard finished the frame (a barrier), so state changed by tasks during a tick
+//     is visible to the caller after Tick returns, and to all tasks on the next tick
+//   - Tasks of the same shard are ticked in the order they were added
+//
+// Tasks of different shards run at the same time, so they must not share state (including yielders) unless that
+// state is safe for concurrent use, and the same task must not be added twice. Add is safe to call from tasks,
+// but all other methods must be called from one goroutine.
+//
+// A parallel scheduler owns worker goroutines, which are stopped with Close. Like with Scheduler, setting the Clock
+// field makes Tick give tasks the time passed on the clock
+type ParallelScheduler struct {
+	ticker
+
+	shards   []*shard
+	barrier  sync.WaitGroup
+	isClosed bool
+
+	// pendingLock guards pending, which holds tasks added since the last tick
+	pendingLock sync.Mutex
+	pending     []Yielder
+
+	finished int
+
+	// The info of the current tick, which is written before the workers are woken up
+	tickInfo    TickInfo
+	tickHasInfo bool
+}
+
+// shard is a set of tasks only ever ticked by one worker goroutine
+type shard struct {
+	tasks    []Yielder
+	finished int
+	work     chan struct{}
+	// panicErr is set if a task panicked on the worker, which Tick panics with on the calling goroutine
+	panicErr *PanicError
+}
+
+// NewParallelScheduler returns a scheduler with the given number of shards and workers.
+// If workers is less than 1, runtime.GOMAXPROCS(0) workers are used
+func NewParallelScheduler(workers int) *ParallelScheduler {
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	s := &ParallelScheduler{
+		shards: make([]*shard, workers),
+	}
+
+	for i := range s.shards {
+		sh := &shard{
+			work: make(chan struct{}),
+		}
+
+		s.shards[i] = sh
+		go s.runWorker(sh)
+	}
+
+	return s
+}
+
+func (s *ParallelScheduler) runWorker(sh *shard) {
+
+	for range sh.work {
+		sh.tick(s.tickInfo, s.tickHasInfo)
+		s.barrier.Done()
+	}
+}
+
+func (sh *shard) tick(info TickInfo, hasInfo bool) {
+
+	// Finished tasks are removed by moving live tasks back over them
+	liveCount := 0
+	i := 0
+	var y Yielder
+
+	defer func() {
+
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		// The stack is only available here, on the worker that panicked
+		sh.panicErr = &PanicError{
+			Value: r,
+			Stack: debug.Stack(),
+		}
+
+		if w, ok := y.(interface{ Where() string }); ok {
+			sh.panicErr.Where = w.Where()
+		}
+
+		// The task that panicked is dropped, and the ones not ticked yet are kept
+		sh.tasks = append(sh.tasks[:liveCount], sh.tasks[i+1:]...)
+	}()
+
+	for ; i < len(sh.tasks); i++ {
+
+		y = sh.tasks[i]
+		sh.tasks[i] = nil
+		if tickYielder(y, info, hasInfo) {
+			sh.finished++
+			continue
+		}
+
+		sh.tasks[liveCount] = y
+		liveCount++
+	}
+
+	sh.tasks = sh.tasks[:liveCount]
+}
+
+// Add gives the task y to the scheduler, which starts ticking it on the next tick. Add is safe for concurrent use
+func (s *ParallelScheduler) Add(y Yielder) {
+
+	s.pendingLock.Lock()
+	s.pending = append(s.pending, y)
+	s.pendingLock.Unlock()
+}
+
+// addPending places the pending tasks in the shards with the least tasks
+func (s *ParallelScheduler) addPending() {
+
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	for i, y := range s.pending {
+
+		smallest := s.shards[0]
+		for _, sh := range s.shards[1:] {
+			if len(sh.tasks) < len(smallest.tasks) {
+				smallest = sh
+			}
+		}
+
+		smallest.tasks = append(smallest.tasks, y)
+		s.pending[i] = nil
+	}
+
+	s.pending = s.pending[:0]
+}
+
+// Tick ticks all live tasks once, and returns true if there are no tasks left
+func (s *ParallelScheduler) Tick() (done bool) {
+
+	return s.tick(s.nextTick())
+}
+
+// TickDelta is like Tick, but passes info to the tasks
+func (s *ParallelScheduler) TickDelta(info TickInfo) (done bool) {
+	return s.tick(s.deltaTick(info))
+}
+
+func (s *ParallelScheduler) tick(info TickInfo, hasInfo bool) (done bool) {
+
+	if s.isClosed {
+		panic("cogo: Tick called on a closed ParallelScheduler")
+	}
+
+	if err := s.ctxErr(); err != nil {
+		s.err = err
+		s.Cancel()
+		return true
+	}
+
+	s.addPending()
+
+	s.tickInfo = info
+	s.tickHasInfo = hasInfo
+
+	// Sending on the work channel makes the tick info visible to the workers, and the
+	// barrier makes the changes done by the workers visible here
+	for _, sh := range s.shards {
+		if len(sh.tasks) == 0 {
+			continue
+		}
+
+		s.barrier.Add(1)
+		sh.work <- struct{}{}
+	}
+
+	s.barrier.Wait()
+
+	var panicErr *PanicError
+	for _, sh := range s.shards {
+
+		s.finished += sh.finished
+		sh.finished = 0
+
+		if sh.panicErr != nil && panicErr == nil {
+			panicErr = sh.panicErr
+		}
+
+		sh.panicErr = nil
+	}
+
+	if panicErr != nil {
+		panic(panicErr)
+	}
+
+	return s.Len() == 0
+}
+
+// Cancel cancels all tasks that implement Canceler and removes all tasks from the scheduler.
+// Tasks are cancelled on the calling goroutine, so like Tick it must not be called by a task
+func (s *ParallelScheduler) Cancel() {
+
+	s.pendingLock.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.pendingLock.Unlock()
+
+	for _, sh := range s.shards {
+
+		tasks := sh.tasks
+		sh.tasks = nil
+
+		for _, y := range tasks {
+			cancelYielder(y)
+		}
+	}
+
+	for _, y := range pending {
+		cancelYielder(y)
+	}
+}
+
+// Len returns the number of tasks that aren't done, including ones that haven't run yet
+func (s *ParallelScheduler) Len() int {
+
+	s.pendingLock.Lock()
+	count := len(s.pending)
+	s.pendingLock.Unlock()
+
+	for _, sh := range s.shards {
+		count += len(sh.tasks)
+	}
+
+	return count
+}
+
+// Finished returns the number of tasks that finished since the scheduler was created
+func (s *ParallelScheduler) Finished() int {
+	return s.finished
+}
+
+// Close stops the worker goroutines. The scheduler must not be ticked after this
+func (s *ParallelScheduler) Close() {
+
+	if s.isClosed {
+		return
+	}
+
+	s.isClosed = true
+	for _, sh := range s.shards {
+		close(sh.work)
+	}
+}
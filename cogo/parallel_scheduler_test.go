@@ -0,0 +1,117 @@
+package cogo
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// shardTask counts its ticks without synchronization, so the race detector reports it if it's ever
+// ticked from two goroutines without a barrier in between
+type shardTask struct {
+	ticks     int
+	ticksLeft int
+	isTicking int32
+	t         *testing.T
+}
+
+func (s *shardTask) Tick() bool {
+
+	if !atomic.CompareAndSwapInt32(&s.isTicking, 0, 1) {
+		s.t.Errorf("task ticked from two goroutines at once")
+	}
+
+	s.ticks++
+	s.ticksLeft--
+
+	atomic.StoreInt32(&s.isTicking, 0)
+	return s.ticksLeft <= 0
+}
+
+func TestParallelSchedulerTicksEachTaskOnce(t *testing.T) {
+
+	s := NewParallelScheduler(4)
+	defer s.Close()
+
+	tasks := make([]*shardTask, 1000)
+	for i := range tasks {
+		tasks[i] = &shardTask{ticksLeft: 1 + i%10, t: t}
+		s.Add(tasks[i])
+	}
+
+	ticks := 0
+	for !s.Tick() {
+		ticks++
+
+		// Reading the counts between ticks relies on the barrier
+		for i, task := range tasks {
+			expected := ticks
+			if expected > 1+i%10 {
+				expected = 1 + i%10
+			}
+
+			if task.ticks != expected {
+				t.Fatalf("expected task %d to be ticked %d times after %d ticks, but got %d", i, expected, ticks, task.ticks)
+			}
+		}
+	}
+
+	if s.Finished() != len(tasks) || s.Len() != 0 {
+		t.Fatalf("expected all %d tasks to be finished, but got %d finished and %d live", len(tasks), s.Finished(), s.Len())
+	}
+}
+
+func TestParallelSchedulerAddFromTasks(t *testing.T) {
+
+	s := NewParallelScheduler(4)
+	defer s.Close()
+
+	var childTicks int32
+	for i := 0; i < 100; i++ {
+		s.Add(funcYielder(func() bool {
+			s.Add(funcYielder(func() bool {
+				atomic.AddInt32(&childTicks, 1)
+				return true
+			}))
+
+			return true
+		}))
+	}
+
+	s.Tick()
+	if atomic.LoadInt32(&childTicks) != 0 || s.Len() != 100 {
+		t.Fatalf("expected 100 children to be added but not ticked, but got %d ticks and %d live tasks", childTicks, s.Len())
+	}
+
+	if !s.Tick() || atomic.LoadInt32(&childTicks) != 100 {
+		t.Fatalf("expected all children to run on the second tick, but got %d ticks", childTicks)
+	}
+}
+
+func TestParallelSchedulerPanic(t *testing.T) {
+
+	s := NewParallelScheduler(2)
+	defer s.Close()
+
+	errBoom := errors.New("boom")
+	s.Add(funcYielder(func() bool {
+		panic(errBoom)
+	}))
+	s.Add(NewFrameWaiter(1))
+
+	func() {
+		defer func() {
+			panicErr, ok := recover().(*PanicError)
+			if !ok || !errors.Is(panicErr, errBoom) || !bytes.Contains(panicErr.Stack, []byte("TestParallelSchedulerPanic")) {
+				t.Fatalf("expected Tick to panic with a PanicError wrapping the task panic and its stack, but got '%v'", panicErr)
+			}
+		}()
+
+		s.Tick()
+	}()
+
+	if s.Len() != 1 {
+		t.Fatalf("expected the task that panicked to be removed, but got %d live tasks", s.Len())
+	}
+}
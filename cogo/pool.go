@@ -0,0 +1,29 @@
+package cogo
+
+import "sync"
+
+// Pool reuses finished coroutines, so that creating many short lived coroutines doesn't allocate.
+// The zero value is ready to use
+type Pool[InT, OutT any] struct {
+	pool sync.Pool
+}
+
+// New is like cogo.New, but reuses a coroutine previously returned with Put if there is one
+func (p *Pool[InT, OutT]) New(coro CoroutineFunc[InT, OutT], input InT) *Coroutine[InT, OutT] {
+
+	c, ok := p.pool.Get().(*Coroutine[InT, OutT])
+	if !ok {
+		c = &Coroutine[InT, OutT]{}
+	}
+
+	c.Init(coro, input)
+	return c
+}
+
+// Put returns c to the pool. c must not be used after this
+func (p *Pool[InT, OutT]) Put(c *Coroutine[InT, OutT]) {
+
+	// Don't keep what the coroutine references alive while it's in the pool
+	*c = Coroutine[InT, OutT]{}
+	p.pool.Put(c)
+}
@@ -0,0 +1,330 @@
+package cogo
+
+import (
+	"sort"
+	"time"
+)
+
+var _ DeltaYielder = &Scheduler{}
+var _ Canceler = &Scheduler{}
+var _ Failer = &Scheduler{}
+
+// waiter is implemented by tasks that can tell if they are blocked on something, like a coroutine in a YieldTo
+type waiter interface {
+	IsWaiting() bool
+}
+
+// Priority is the priority class of a scheduler task. Tasks of a higher priority class are ticked first
+type Priority int
+
+const (
+	PriorityLow    Priority = -10
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 10
+)
+
+// SchedulerStats are the counts of tasks of a scheduler as of its last tick
+type SchedulerStats struct {
+	// Running tasks are live tasks that aren't waiting on anything
+	Running int
+	// Waiting tasks are live tasks blocked on a yielder, like a coroutine in a YieldTo
+	Waiting int
+	// Pending tasks were added since the last tick and haven't run yet
+	Pending int
+	// Finished is the number of tasks that finished since the scheduler was created
+	Finished int
+	// Skipped is the number of live tasks that weren't ticked in the last tick because the budget ran out
+	Skipped int
+	// MaxStarvation is the largest number of ticks any live task has gone without being ticked
+	MaxStarvation uint64
+}
+
+// Scheduler owns many tasks (coroutines or any other yielders) and ticks them together, removing tasks once they are done.
+//
+// Tasks can be added at any time, including by a task while the scheduler is ticking it, in which case the new task
+// starts running on the next tick. A scheduler is itself a yielder that is done once it has no tasks left.
+//
+// If a Budget is set, a tick stops once the budget is used up, and the next tick continues from the tasks
+// that were skipped (round-robin). A skipped task gets the delta time of the ticks it missed once it's ticked
+// again. Higher priority classes always go first, so lower ones can starve, which is reported by Stats.
+//
+// Tasks are given the delta times passed to TickDelta, or if the Clock field is set, the time passed on it between ticks.
+// A scheduler isn't safe for concurrent use
+type Scheduler struct {
+	ticker
+	// Budget is the wall clock time a tick may take. Zero means every task is ticked every time
+	Budget time.Duration
+	// BudgetClock measures the budget. If not set the wall clock is used
+	BudgetClock Clock
+
+	classes   []*taskClass
+	pending   []schedTask
+	isTicking bool
+	frame     uint64
+	// elapsed is the sum of the delta times of all ticks
+	elapsed time.Duration
+	stats   SchedulerStats
+}
+
+type schedTask struct {
+	y        Yielder
+	priority Priority
+	// lastFrame is the scheduler frame the task was last ticked in (or added in)
+	lastFrame uint64
+	// lastElapsed is the elapsed time of the scheduler when the task was last ticked (or added), so that
+	// a task skipped because of the budget gets the time it missed on its next tick
+	lastElapsed time.Duration
+}
+
+// taskClass holds the tasks of one priority, which are ticked round-robin starting at next
+type taskClass struct {
+	priority Priority
+	tasks    []schedTask
+	next     int
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add gives the task y to the scheduler with a normal priority
+func (s *Scheduler) Add(y Yielder) {
+	s.AddWithPriority(y, PriorityNormal)
+}
+
+// AddWithPriority gives the task y to the scheduler in the priority class p
+func (s *Scheduler) AddWithPriority(y Yielder, p Priority) {
+
+	task := schedTask{
+		y:           y,
+		priority:    p,
+		lastFrame:   s.frame,
+		lastElapsed: s.elapsed,
+	}
+
+	if s.isTicking {
+		s.pending = append(s.pending, task)
+	} else {
+		s.addTask(task)
+	}
+
+	s.stats.Pending++
+}
+
+func (s *Scheduler) addTask(task schedTask) {
+
+	class := s.getClass(task.priority)
+	class.tasks = append(class.tasks, task)
+}
+
+func (s *Scheduler) getClass(p Priority) *taskClass {
+
+	i := sort.Search(len(s.classes), func(i int) bool {
+		return s.classes[i].priority <= p
+	})
+
+	if i < len(s.classes) && s.classes[i].priority == p {
+		return s.classes[i]
+	}
+
+	// Classes are kept in order of decreasing priority
+	class := &taskClass{priority: p}
+	s.classes = insertIntoArr(s.classes, i, class)
+	return class
+}
+
+// Tick ticks all live tasks once (or as many as the budget allows), and returns true if there are no tasks left
+func (s *Scheduler) Tick() (done bool) {
+
+	return s.tick(s.nextTick())
+}
+
+// TickDelta is like Tick, but passes info to the tasks
+func (s *Scheduler) TickDelta(info TickInfo) (done bool) {
+	return s.tick(s.deltaTick(info))
+}
+
+func (s *Scheduler) tick(info TickInfo, hasInfo bool) (done bool) {
+
+	if err := s.ctxErr(); err != nil {
+		s.err = err
+		s.Cancel()
+		return true
+	}
+
+	s.frame++
+	s.elapsed += info.Delta
+	s.isTicking = true
+
+	budgetClock := s.BudgetClock
+	if budgetClock == nil {
+		budgetClock = RealClock
+	}
+
+	// At least one task is ticked per tick, so that a tiny budget still makes progress
+	var start time.Time
+	if s.Budget > 0 {
+		start = budgetClock.Now()
+	}
+
+	tickedAny := false
+	isOutOfBudget := func() bool {
+		return s.Budget > 0 && tickedAny && budgetClock.Now().Sub(start) >= s.Budget
+	}
+
+	for _, class := range s.classes {
+
+		ticked := 0
+		for ticked < len(class.tasks) && !isOutOfBudget() {
+
+			i := class.next + ticked
+			if i >= len(class.tasks) {
+				i -= len(class.tasks)
+			}
+
+			task := &class.tasks[i]
+			taskInfo := TickInfo{Delta: s.elapsed - task.lastElapsed, Frame: info.Frame}
+			if tickYielder(task.y, taskInfo, hasInfo) {
+				task.y = nil
+				s.stats.Finished++
+			}
+
+			task.lastFrame = s.frame
+			task.lastElapsed = s.elapsed
+			tickedAny = true
+			ticked++
+		}
+
+		if len(class.tasks) > 0 {
+			class.next = (class.next + ticked) % len(class.tasks)
+		}
+	}
+
+	s.isTicking = false
+	s.removeFinishedTasks()
+
+	// Tasks added during the tick run starting from the next one
+	s.stats.Pending = len(s.pending)
+	for i := range s.pending {
+		s.addTask(s.pending[i])
+		s.pending[i] = schedTask{}
+	}
+
+	s.pending = s.pending[:0]
+	return s.Len() == 0
+}
+
+// removeFinishedTasks removes the done tasks and updates the stats of the live ones
+func (s *Scheduler) removeFinishedTasks() {
+
+	s.stats.Running = 0
+	s.stats.Waiting = 0
+	s.stats.Skipped = 0
+	s.stats.MaxStarvation = 0
+
+	liveClasses := s.classes[:0]
+	for _, class := range s.classes {
+
+		// Finished tasks are removed by moving live tasks back over them, while keeping
+		// the round-robin position at the same task
+		liveCount := 0
+		newNext := 0
+		for i, task := range class.tasks {
+
+			if i == class.next {
+				newNext = liveCount
+			}
+
+			if task.y == nil {
+				continue
+			}
+
+			if w, ok := task.y.(waiter); ok && w.IsWaiting() {
+				s.stats.Waiting++
+			} else {
+				s.stats.Running++
+			}
+
+			if task.lastFrame != s.frame {
+				s.stats.Skipped++
+			}
+
+			if starvation := s.frame - task.lastFrame; starvation > s.stats.MaxStarvation {
+				s.stats.MaxStarvation = starvation
+			}
+
+			class.tasks[liveCount] = task
+			liveCount++
+		}
+
+		// Clear the removed tasks so they can be garbage collected
+		for i := liveCount; i < len(class.tasks); i++ {
+			class.tasks[i] = schedTask{}
+		}
+
+		class.tasks = class.tasks[:liveCount]
+		if liveCount == 0 {
+			continue
+		}
+
+		class.next = newNext % liveCount
+		liveClasses = append(liveClasses, class)
+	}
+
+	for i := len(liveClasses); i < len(s.classes); i++ {
+		s.classes[i] = nil
+	}
+
+	s.classes = liveClasses
+}
+
+// Cancel cancels all tasks that implement Canceler and removes all tasks from the scheduler.
+// It must not be called by a task of the scheduler while it's ticking
+func (s *Scheduler) Cancel() {
+
+	if s.isTicking {
+		panic("cogo: Scheduler.Cancel can't be called while the scheduler is ticking")
+	}
+
+	classes := s.classes
+	pending := s.pending
+	s.classes = nil
+	s.pending = nil
+
+	for _, class := range classes {
+		for _, task := range class.tasks {
+			cancelYielder(task.y)
+		}
+	}
+
+	for _, task := range pending {
+		cancelYielder(task.y)
+	}
+}
+
+// Len returns the number of tasks that aren't done, including ones that haven't run yet
+func (s *Scheduler) Len() int {
+
+	count := len(s.pending)
+	for _, class := range s.classes {
+		count += len(class.tasks)
+	}
+
+	return count
+}
+
+// Stats returns the task counts of the scheduler
+func (s *Scheduler) Stats() SchedulerStats {
+	return s.stats
+}
+
+func insertIntoArr[T any](a []T, index int, value T) []T {
+
+	if len(a) == index {
+		return append(a, value)
+	}
+
+	a = append(a[:index+1], a[index:]...)
+	a[index] = value
+	return a
+}
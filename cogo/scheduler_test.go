@@ -0,0 +1,197 @@
+package cogo
+
+import (
+	"testing"
+	"time"
+)
+
+// funcYielder is a yielder that runs a function on every tick
+type funcYielder func() bool
+
+func (f funcYielder) Tick() bool {
+	return f()
+}
+
+func TestSchedulerRemovesFinishedTasks(t *testing.T) {
+
+	s := NewScheduler()
+	s.Add(NewFrameWaiter(0))
+	s.Add(NewFrameWaiter(2))
+
+	if s.Tick() {
+		t.Fatalf("expected scheduler to have tasks left after the first tick")
+	}
+
+	if s.Len() != 1 || s.Stats().Finished != 1 {
+		t.Fatalf("expected 1 live and 1 finished task, but got %d live and stats %+v", s.Len(), s.Stats())
+	}
+
+	s.Tick()
+	if !s.Tick() {
+		t.Fatalf("expected scheduler to be done after all tasks finished")
+	}
+
+	if s.Len() != 0 || s.Stats().Finished != 2 {
+		t.Fatalf("expected no live and 2 finished tasks, but got %d live and stats %+v", s.Len(), s.Stats())
+	}
+}
+
+func TestSchedulerAddDuringTick(t *testing.T) {
+
+	s := NewScheduler()
+
+	childTicks := 0
+	child := funcYielder(func() bool {
+		childTicks++
+		return true
+	})
+
+	s.Add(funcYielder(func() bool {
+		s.Add(child)
+		return true
+	}))
+
+	s.Tick()
+	if childTicks != 0 {
+		t.Fatalf("expected a task added during a tick to not run in the same tick")
+	}
+
+	if s.Stats().Pending != 1 {
+		t.Fatalf("expected 1 pending task, but got stats %+v", s.Stats())
+	}
+
+	if !s.Tick() || childTicks != 1 {
+		t.Fatalf("expected the added task to run once on the next tick, but it ran %d times", childTicks)
+	}
+}
+
+func TestSchedulerCountsWaitingCoroutines(t *testing.T) {
+
+	// A hand written coroutine that waits on a yielder for 2 frames
+	waiting := New(func(c *Coroutine[int, int]) {
+
+		if c.State() == 0 {
+			c.SuspendTo(1, NewFrameWaiter(2))
+			return
+		}
+
+		c.MarkDone()
+	}, 0)
+
+	running := New(func(c *Coroutine[int, int]) {}, 0)
+
+	s := NewScheduler()
+	s.Add(waiting)
+	s.Add(running)
+	s.Tick()
+
+	stats := s.Stats()
+	if stats.Waiting != 1 || stats.Running != 1 {
+		t.Fatalf("expected 1 waiting and 1 running task, but got stats %+v", stats)
+	}
+}
+
+func TestSchedulerBudgetRoundRobin(t *testing.T) {
+
+	clock := NewFakeClock(time.Time{})
+	s := NewScheduler()
+	s.Budget = 3 * time.Millisecond
+	s.BudgetClock = clock
+
+	// Every task takes 1ms, so 3 of them fit in a tick
+	tickCounts := make([]int, 5)
+	for i := range tickCounts {
+
+		i := i
+		s.Add(funcYielder(func() bool {
+			tickCounts[i]++
+			clock.Advance(time.Millisecond)
+			return false
+		}))
+	}
+
+	s.Tick()
+	s.Tick()
+
+	expected := []int{2, 1, 1, 1, 1}
+	for i := range expected {
+		if tickCounts[i] != expected[i] {
+			t.Fatalf("expected tick counts %v, but got %v", expected, tickCounts)
+		}
+	}
+
+	stats := s.Stats()
+	if stats.Skipped != 2 || stats.MaxStarvation != 1 {
+		t.Fatalf("expected 2 skipped tasks with a starvation of 1, but got stats %+v", stats)
+	}
+}
+
+func TestSchedulerPriorities(t *testing.T) {
+
+	clock := NewFakeClock(time.Time{})
+	s := NewScheduler()
+	s.Budget = time.Millisecond
+	s.BudgetClock = clock
+
+	lowTicks := 0
+	s.AddWithPriority(funcYielder(func() bool {
+		lowTicks++
+		return false
+	}), PriorityLow)
+
+	highTicks := 0
+	s.AddWithPriority(funcYielder(func() bool {
+		highTicks++
+		clock.Advance(time.Millisecond)
+		return false
+	}), PriorityHigh)
+
+	for i := 0; i < 3; i++ {
+		s.Tick()
+	}
+
+	if highTicks != 3 || lowTicks != 0 {
+		t.Fatalf("expected only the high priority task to run, but high ran %d times and low ran %d times", highTicks, lowTicks)
+	}
+
+	if s.Stats().MaxStarvation != 3 {
+		t.Fatalf("expected the low priority task to be starved for 3 ticks, but got stats %+v", s.Stats())
+	}
+}
+
+// slowTask is a delta yielder that uses up a millisecond of the budget clock whenever it's ticked
+type slowTask struct {
+	y     DeltaYielder
+	clock *FakeClock
+}
+
+func (t *slowTask) Tick() bool {
+	t.clock.Advance(time.Millisecond)
+	return t.y.Tick()
+}
+
+func (t *slowTask) TickDelta(info TickInfo) bool {
+	t.clock.Advance(time.Millisecond)
+	return t.y.TickDelta(info)
+}
+
+func TestSchedulerBudgetKeepsSkippedTime(t *testing.T) {
+
+	clock := NewFakeClock(time.Time{})
+	s := NewScheduler()
+	s.Budget = time.Millisecond
+	s.BudgetClock = clock
+
+	// Only one task fits in a tick, so each sleeper is ticked every other frame with the time of both frames
+	s.Add(&slowTask{y: NewSleeper(100 * time.Millisecond), clock: clock})
+	s.Add(&slowTask{y: NewSleeper(100 * time.Millisecond), clock: clock})
+
+	ticks := 1
+	for !s.TickDelta(TickInfo{Delta: 10 * time.Millisecond}) {
+		ticks++
+	}
+
+	if ticks != 11 {
+		t.Fatalf("expected both 100ms sleepers to be done after 110ms of game time, but it took %d ticks of 10ms", ticks)
+	}
+}
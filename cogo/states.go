@@ -0,0 +1,64 @@
+package cogo
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// StateInfo describes where a coroutine is suspended when it has a given State.
+// The generator registers one for every yield of every coroutine
+type StateInfo struct {
+	State int32
+	// Label is the name given to the yield with '//cogo:state name=xyz', if any
+	Label string
+	// Kind is the kind of yield, e.g. 'YieldTo'
+	Kind string
+	File string
+	Line int
+}
+
+func (s StateInfo) String() string {
+
+	if s.Label == "" {
+		return fmt.Sprintf("%s:%d", s.File, s.Line)
+	}
+
+	return fmt.Sprintf("%s:%d (%s)", s.File, s.Line, s.Label)
+}
+
+var (
+	statesLock   sync.RWMutex
+	statesByFunc = map[uintptr]map[int32]StateInfo{}
+)
+
+// RegisterStates registers the states of a coroutine under each of the passed functions, which are
+// normally the original coroutine and its generated version. This is called by generated code
+func RegisterStates[InT, OutT any](states []StateInfo, funcs ...CoroutineFunc[InT, OutT]) {
+
+	statesMap := make(map[int32]StateInfo, len(states))
+	for _, s := range states {
+		statesMap[s.State] = s
+	}
+
+	statesLock.Lock()
+	defer statesLock.Unlock()
+
+	for _, f := range funcs {
+		statesByFunc[reflect.ValueOf(f).Pointer()] = statesMap
+	}
+}
+
+// LookupState returns the info of a state of the coroutine function f, if it was registered
+func LookupState[InT, OutT any](f CoroutineFunc[InT, OutT], state int32) (info StateInfo, ok bool) {
+
+	if f == nil {
+		return StateInfo{}, false
+	}
+
+	statesLock.RLock()
+	defer statesLock.RUnlock()
+
+	info, ok = statesByFunc[reflect.ValueOf(f).Pointer()][state]
+	return info, ok
+}
@@ -0,0 +1,44 @@
+package cogo
+
+// Status is what a coroutine is currently doing, as returned by Coroutine.Status
+type Status int8
+
+const (
+	// StatusCreated coroutines haven't started running their function yet, either because they are new, or because they
+	// were restarted by Reset or Loop
+	StatusCreated Status = iota
+	// StatusRunning coroutines are being ticked right now
+	StatusRunning
+	// StatusSuspended coroutines are suspended at a yield, and resume on the next tick
+	StatusSuspended
+	// StatusWaitingOnYielder coroutines are suspended at a YieldTo, and resume once its yielder is done
+	StatusWaitingOnYielder
+	// StatusDone coroutines returned
+	StatusDone
+	// StatusCancelled coroutines were stopped with Cancel
+	StatusCancelled
+	// StatusFailed coroutines were stopped with an error, see Coroutine.Err
+	StatusFailed
+)
+
+func (s Status) String() string {
+
+	switch s {
+	case StatusCreated:
+		return "created"
+	case StatusRunning:
+		return "running"
+	case StatusSuspended:
+		return "suspended"
+	case StatusWaitingOnYielder:
+		return "waiting on yielder"
+	case StatusDone:
+		return "done"
+	case StatusCancelled:
+		return "cancelled"
+	case StatusFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
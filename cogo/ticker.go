@@ -0,0 +1,83 @@
+package cogo
+
+import "context"
+
+// ticker is embedded by coroutines and schedulers for what they share about being ticked: the clock
+// they tick on, the info of the last tick, the context they are bound to, and the error it cancelled them with.
+// The Clock field and the exported methods are promoted, so they are documented on the types embedding it too
+type ticker struct {
+	// Clock, if set, is used by Tick to find the delta time of every tick, which is then passed on like with TickDelta.
+	// This makes yielders like Sleeper run on the clock instead of the wall clock
+	Clock Clock
+
+	lastTick   TickInfo
+	clockTimer clockTimer
+	// ctxDone is the Done channel of ctx, which is nil if ctx can't be cancelled
+	ctx     context.Context
+	ctxDone <-chan struct{}
+	err     error
+}
+
+// clockTicker is implemented by the coroutines and schedulers embedding a ticker
+type clockTicker interface {
+	hasClock() bool
+}
+
+// hasClock returns true if Tick runs on a Clock, which Run uses to tell which yielders it shouldn't pass wall clock deltas to
+func (t *ticker) hasClock() bool {
+	return t.Clock != nil
+}
+
+// nextTick returns the info Tick passes on, which is only set if there is a clock
+func (t *ticker) nextTick() (info TickInfo, hasInfo bool) {
+
+	if t.Clock == nil {
+		return TickInfo{}, false
+	}
+
+	return t.deltaTick(t.clockTimer.nextTick(t.Clock, t.lastTick.Frame))
+}
+
+// deltaTick returns the info TickDelta passes on, which is kept as the last tick
+func (t *ticker) deltaTick(info TickInfo) (TickInfo, bool) {
+	t.lastTick = info
+	return info, true
+}
+
+// ctxErr returns the error of the context once it's done, which every tick checks before running anything
+func (t *ticker) ctxErr() error {
+
+	if !isChanClosed(t.ctxDone) {
+		return nil
+	}
+
+	return t.ctx.Err()
+}
+
+// LastTick returns the info passed to the last TickDelta call, which coroutines can use for things
+// like moving by 'speed * c.LastTick().Delta.Seconds()'
+func (t *ticker) LastTick() TickInfo {
+	return t.lastTick
+}
+
+// SetContext binds to ctx, so that once ctx is cancelled or its deadline passes the next tick cancels
+// everything that's running, with ctx.Err() as the error
+func (t *ticker) SetContext(ctx context.Context) {
+	t.ctx = ctx
+	t.ctxDone = ctx.Done()
+}
+
+// Context returns the context set with SetContext, or context.Background() if there is none
+func (t *ticker) Context() context.Context {
+
+	if t.ctx == nil {
+		return context.Background()
+	}
+
+	return t.ctx
+}
+
+// Err returns the error of the context once it cancelled everything
+func (t *ticker) Err() error {
+	return t.err
+}
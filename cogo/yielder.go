@@ -1,5 +1,22 @@
 package cogo
 
+import "time"
+
 type Yielder interface {
 	Tick() (done bool)
 }
+
+// TickInfo describes the frame a tick happens in
+type TickInfo struct {
+	// Delta is the time passed since the previous tick. This is game time, so it can be a fixed timestep,
+	// slowed down, or zero while paused
+	Delta time.Duration
+	Frame uint64
+}
+
+// DeltaYielder is a Yielder that can use the delta time of ticks, for example to run on a game clock.
+// When ticked with Coroutine.TickDelta, TickDelta is called instead of Tick
+type DeltaYielder interface {
+	Yielder
+	TickDelta(info TickInfo) (done bool)
+}
@@ -1,4 +1,5 @@
 // Code generated by 'cogo'; DO NOT EDIT.
+// cogo-hash: 8f235932e98dca8c98936ca9c8f7a31fde5a7654828f43067f6a65fc4873bd06
 package main
 
 import (
@@ -8,47 +9,77 @@ import (
 )
 
 func test_cogo(c *cogo.Coroutine[int, int]) {
-	switch c.State {
-	case 1:
-		goto cogo_1_1
-	case 2:
-		c.State = 1
-		goto cogo_2_0
-	case 3:
-		goto cogo_1_3
+	switch c.State() {
+	case test_cogo_State1:
+		goto cogo_1
+	case test_cogo_State2:
+		goto cogo_3
+	case test_cogo_State3:
+		goto cogo_4
+	case test_cogo_State4:
+		goto cogo_5
+	case test_cogo_State5:
+		goto cogo_6
 	}
 
 	println("test yield:", 1)
 	{
-		c.State = 1
+		c.Suspend(test_cogo_State1)
 		c.Out = 1
 		return
 	}
-cogo_1_1:
+cogo_1:
 	;
-cogo_2_0:
+	if !(c.Out > 2) {
+		goto cogo_2
+	}
+	{
+		c.Suspend(test_cogo_State2)
+		c.Out = 1
+		return
+	}
+cogo_3:
 	;
-
-	if c.Out > 2 {
-		switch c.State {
-		case 1:
-			goto cogo_2_1
-		}
-		{
-			c.State = 2
-			c.Out = 1
-			return
-		}
-	cogo_2_1:
+cogo_2:
+	;
+	{
+		c.SuspendTo(test_cogo_State3, cogo.NewSleeper(100*time.Millisecond))
+		return
 	}
-
-	c.YieldTo(cogo.NewSleeper(100 * time.Millisecond))
+cogo_4:
+	;
+	{
+		c.SuspendTo(test_cogo_State4, waitFrames(2))
+		return
+	}
+cogo_5:
+	;
 
 	println("test yield:", 2)
 	{
-		c.State = 3
+		c.Suspend(test_cogo_State5)
 		c.Out = 2
 		return
 	}
-cogo_1_3:
+cogo_6:
+	;
+	c.MarkDone()
+}
+
+const (
+	test_cogo_State1 int32 = 1
+	test_cogo_State2 int32 = 2
+	test_cogo_State3 int32 = 3
+	test_cogo_State4 int32 = 4
+	test_cogo_State5 int32 = 5
+)
+
+func init() {
+	cogo.RegisterStates([]cogo.StateInfo{
+		{State: test_cogo_State1, Kind: "Yield", File: "demo.go", Line: 35},
+		{State: test_cogo_State2, Kind: "Yield", File: "demo.go", Line: 38},
+		{State: test_cogo_State3, Kind: "YieldTo", File: "demo.go", Line: 42},
+		{State: test_cogo_State4, Kind: "YieldTo", File: "demo.go", Line: 45},
+		{State: test_cogo_State5, Kind: "Yield", File: "demo.go", Line: 51},
+	}, test_cogo, test)
 }
@@ -9,17 +9,24 @@ import (
 
 func runDemo() {
 
-	c := cogo.New(test, 0)
+	// A fake clock advanced by a fixed timestep means the demo doesn't need to actually wait
+	clock := cogo.NewFakeClock(time.Now())
+	start := clock.Now()
+
+	s := cogo.NewScheduler()
+	s.Clock = clock
+
+	c := cogo.New(test_cogo, 0)
+	s.Add(c)
 
 	ticks := 1
-	start := time.Now()
-	for done := c.Tick(); !done; done = c.Tick() {
+	for done := s.Tick(); !done; done = s.Tick() {
 		println("Ticks done:", ticks, "; Output:", c.Out, "\n")
 		ticks++
-		time.Sleep(1 * time.Millisecond)
+		clock.Advance(16 * time.Millisecond)
 	}
 
-	println("Time taken:", time.Since(start).String())
+	println("Game time taken:", clock.Now().Sub(start).String())
 }
 
 func test(c *cogo.Coroutine[int, int]) {
@@ -34,6 +41,9 @@ func test(c *cogo.Coroutine[int, int]) {
 	// Yield here until at least 100ms passed
 	c.YieldTo(cogo.NewSleeper(100 * time.Millisecond))
 
+	// Yield here for 2 frames using our own yield macro
+	waitFrames(2)
+
 	// Yield here until the coroutine 'test2' has finished
 	// c.YieldTo(cogo.New(test2, 0))
 
@@ -41,6 +51,13 @@ func test(c *cogo.Coroutine[int, int]) {
 	c.Yield(2)
 }
 
+// waitFrames is a yield macro, so calling it inside a coroutine suspends it until n frames have passed
+//
+//cogo:yield
+func waitFrames(n int) cogo.Yielder {
+	return cogo.NewFrameWaiter(n)
+}
+
 // func test2(c *cogo.Coroutine[int, int]) {
 
 // 	println("test2222 yield:", 1)
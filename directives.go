@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+const (
+	directivePrefix = "//cogo:"
+
+	// cogoPkgPath is the import path of the cogo runtime package
+	cogoPkgPath = "github.com/bloeys/cogo/cogo"
+)
+
+// Directive is a comment in the style of '//cogo:name key=value key2=value2'
+type Directive struct {
+	Pos  token.Pos
+	Name string
+	Args map[string]string
+}
+
+// parseDirectives returns all cogo directives in the comment group
+func parseDirectives(fset *token.FileSet, cg *ast.CommentGroup) (directives []Directive) {
+
+	if cg == nil {
+		return nil
+	}
+
+	for _, comment := range cg.List {
+
+		if !strings.HasPrefix(comment.Text, directivePrefix) {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(comment.Text, directivePrefix))
+		if len(fields) == 0 {
+			panic(fmt.Sprintf("%s: cogo directive is missing a name", fset.Position(comment.Pos())))
+		}
+
+		d := Directive{
+			Pos:  comment.Pos(),
+			Name: fields[0],
+			Args: map[string]string{},
+		}
+
+		for _, f := range fields[1:] {
+
+			key, val, found := strings.Cut(f, "=")
+			if !found || key == "" || val == "" {
+				panic(fmt.Sprintf("%s: invalid argument '%s' to cogo directive '%s'. Arguments must be in the form 'key=value'", fset.Position(comment.Pos()), f, d.Name))
+			}
+
+			d.Args[key] = val
+		}
+
+		directives = append(directives, d)
+	}
+
+	return directives
+}
+
+// FuncDirectives are the options set by directives in the doc comment of a function
+type FuncDirectives struct {
+	// Coroutine is set by '//cogo:coroutine' and forces the function to be treated as a coroutine
+	Coroutine bool
+	// Ignore is set by '//cogo:ignore' and stops any code being generated for the function
+	Ignore bool
+	// GenName is set by '//cogo:coroutine name=xyz' and is the name of the generated function
+	GenName string
+	// ParamName is set by '//cogo:coroutine param=xyz' and is the name of the coroutine parameter
+	ParamName string
+	// Yield is set by '//cogo:yield' and marks the function as a yield macro
+	Yield bool
+}
+
+func getFuncDirectives(fset *token.FileSet, funcDecl *ast.FuncDecl) (fd FuncDirectives) {
+
+	for _, d := range parseDirectives(fset, funcDecl.Doc) {
+
+		switch d.Name {
+		case "coroutine":
+
+			fd.Coroutine = true
+			for k, v := range d.Args {
+
+				switch k {
+				case "name":
+					fd.GenName = v
+				case "param":
+					fd.ParamName = v
+				default:
+					panic(fmt.Sprintf("%s: unknown argument '%s' to cogo directive 'coroutine'", fset.Position(d.Pos), k))
+				}
+			}
+
+		case "ignore":
+			fd.Ignore = true
+
+		case "yield":
+			fd.Yield = true
+
+		default:
+			panic(fmt.Sprintf("%s: unknown cogo directive '%s' on function '%s'", fset.Position(d.Pos), d.Name, funcDecl.Name.Name))
+		}
+	}
+
+	if fd.Coroutine && fd.Ignore {
+		panic(fmt.Sprintf("%s: function '%s' can't have both '//cogo:coroutine' and '//cogo:ignore'", fset.Position(funcDecl.Pos()), funcDecl.Name.Name))
+	}
+
+	if fd.Coroutine && fd.Yield {
+		panic(fmt.Sprintf("%s: function '%s' can't have both '//cogo:coroutine' and '//cogo:yield'", fset.Position(funcDecl.Pos()), funcDecl.Name.Name))
+	}
+
+	return fd
+}
+
+// fileIsIgnored returns true if a '//cogo:ignore' directive appears before the package clause
+func fileIsIgnored(fset *token.FileSet, f *ast.File) bool {
+
+	for _, cg := range f.Comments {
+
+		if cg.Pos() > f.Package {
+			break
+		}
+
+		for _, d := range parseDirectives(fset, cg) {
+			if d.Name == "ignore" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getGenFuncName returns the name of the generated version of funcDecl
+func getGenFuncName(funcDecl *ast.FuncDecl, fd FuncDirectives) string {
+
+	if fd.GenName != "" {
+		return fd.GenName
+	}
+
+	return funcDecl.Name.Name + "_cogo"
+}
+
+// resolveCoroutineParamName returns the name of the coroutine parameter of funcDecl or an empty string if
+// it isn't a coroutine.
+//
+// Normally the parameter must be written as '*cogo.Coroutine[...]', but functions marked
+// with '//cogo:coroutine' may name the parameter or have its type resolved through aliases
+func resolveCoroutineParamName(fset *token.FileSet, typesInfo *types.Info, funcDecl *ast.FuncDecl, fd FuncDirectives) string {
+
+	if fd.ParamName != "" {
+
+		for _, field := range funcDecl.Type.Params.List {
+			for _, name := range field.Names {
+				if name.Name == fd.ParamName {
+					return fd.ParamName
+				}
+			}
+		}
+
+		panic(fmt.Sprintf("%s: function '%s' has no parameter named '%s'", fset.Position(funcDecl.Pos()), funcDecl.Name.Name, fd.ParamName))
+	}
+
+	coroutineParamName := getCoroutineParamNameFromFuncDecl(funcDecl)
+	if coroutineParamName != "" || !fd.Coroutine {
+		return coroutineParamName
+	}
+
+	for _, field := range funcDecl.Type.Params.List {
+
+		if len(field.Names) > 0 && isCoroutineType(typesInfo.TypeOf(field.Type)) {
+			return field.Names[0].Name
+		}
+	}
+
+	panic(fmt.Sprintf("%s: function '%s' is marked with '//cogo:coroutine' but has no '*cogo.Coroutine' parameter", fset.Position(funcDecl.Pos()), funcDecl.Name.Name))
+}
+
+// isCoroutineType returns true if t is a '*cogo.Coroutine[InT, OutT]'
+func isCoroutineType(t types.Type) bool {
+
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+
+	named, ok := unalias(ptr.Elem()).(*types.Named)
+	if !ok {
+		return false
+	}
+
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == cogoPkgPath && obj.Name() == "Coroutine"
+}
+
+// unalias returns the type a type alias refers to. We can't use types.Unalias
+// because aliases only got their own type (types.Alias) in newer versions of Go
+func unalias(t types.Type) types.Type {
+
+	for {
+
+		alias, ok := t.(interface{ Rhs() types.Type })
+		if !ok {
+			return t
+		}
+
+		t = alias.Rhs()
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// fixBlockingCalls rewrites blocking calls inside coroutines into their cooperative
+// equivalents, for example 'time.Sleep(d)' becomes 'c.YieldTo(cogo.NewSleeper(d))'.
+//
+// Only functions that are already coroutines (they yield or are marked with '//cogo:coroutine') are rewritten.
+// Every rewrite is reported, and if dryRun is true the files are left untouched. Files whose fixed code doesn't
+// compile are reported and left untouched as well
+func fixBlockingCalls(cwd string, patterns []string, dryRun bool) {
+
+	pkgs, err := packages.Load(&packages.Config{
+		Dir:   cwd,
+		Mode:  packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Tests: false,
+	}, patterns...)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(pkgs) == 0 {
+		return
+	}
+
+	macros := newYieldMacroFinder(pkgs[0].Fset)
+	for _, pkg := range pkgs {
+		fixPkgBlockingCalls(pkg, macros, dryRun)
+	}
+}
+
+func fixPkgBlockingCalls(pkg *packages.Package, macros *yieldMacroFinder, dryRun bool) {
+
+	f := &fixer{
+		p: newProcessor(pkg, macros),
+	}
+
+	for _, synFile := range pkg.Syntax {
+
+		origFName := pkg.Fset.File(synFile.Pos()).Name()
+		if isCogoFile(origFName) || fileIsIgnored(pkg.Fset, synFile) {
+			continue
+		}
+
+		f.fixCount = 0
+		astutil.Apply(synFile, f.nodeProcessor, nil)
+		if f.fixCount == 0 || dryRun {
+			continue
+		}
+
+		src := formatAst(origFName, "", pkg.Fset, synFile)
+		typeErrs := getNewTypeErrors(pkg, origFName, src)
+		for _, typeErr := range typeErrs {
+			fmt.Fprintf(os.Stderr, "%s: fixed code does not compile: %s\n", typeErr.Fset.Position(typeErr.Pos), typeErr.Msg)
+		}
+
+		if len(typeErrs) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: not writing the fixed file because it doesn't compile\n", origFName)
+			continue
+		}
+
+		writeFile(origFName, src)
+	}
+}
+
+// getNewTypeErrors returns the type errors the package would have in fName with src as its source, which it doesn't have
+// with the current source. Errors that were there before (like calls to coroutines that aren't generated yet) are ignored
+func getNewTypeErrors(pkg *packages.Package, fName string, src []byte) (typeErrs []types.Error) {
+
+	origSrc, err := os.ReadFile(fName)
+	if err != nil {
+		panic("Failed to read file " + fName + ". Err: " + err.Error())
+	}
+
+	_, _, origTypeErrs := checkPkgWithFiles(pkg, map[string][]byte{fName: origSrc})
+	origMsgs := map[string]int{}
+	for _, typeErr := range origTypeErrs {
+		origMsgs[typeErr.Msg]++
+	}
+
+	_, _, newTypeErrs := checkPkgWithFiles(pkg, map[string][]byte{fName: src})
+	for _, typeErr := range newTypeErrs {
+
+		if origMsgs[typeErr.Msg] > 0 {
+			origMsgs[typeErr.Msg]--
+			continue
+		}
+
+		typeErrs = append(typeErrs, typeErr)
+	}
+
+	return typeErrs
+}
+
+type fixer struct {
+	// p is only used to find which functions are coroutines
+	p        *processor
+	fixCount int
+}
+
+func (f *fixer) nodeProcessor(c *astutil.Cursor) bool {
+
+	n := c.Node()
+	if n == nil {
+		return false
+	}
+
+	funcDecl, ok := n.(*ast.FuncDecl)
+	if !ok || funcDecl.Body == nil {
+		return true
+	}
+
+	fset := f.p.fset
+	funcDirectives := getFuncDirectives(fset, funcDecl)
+	if funcDirectives.Ignore || funcDirectives.Yield {
+		return false
+	}
+
+	coroutineParamName := resolveCoroutineParamName(fset, f.p.typesInfo, funcDecl, funcDirectives)
+	if coroutineParamName == "" {
+		return false
+	}
+
+	// Functions that take a coroutine but never yield are called directly, so they must keep blocking
+	isCoroutine := funcDirectives.Coroutine || f.p.usesCogo(funcDecl.Body, coroutineParamName)
+
+	astutil.Apply(funcDecl.Body, func(c *astutil.Cursor) bool {
+
+		// Function literals don't run as part of the coroutine (e.g. 'go func(){...}()'), so we leave them alone
+		if _, ok := c.Node().(*ast.FuncLit); ok {
+			return false
+		}
+
+		// The receive of a select case can't be replaced by a yield, since a case must be a send or a receive
+		if c.Name() == "Comm" {
+			return false
+		}
+
+		exprStmt, ok := c.Node().(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+
+		yielderExpr := f.getYielderForBlockingExpr(exprStmt.X)
+		if yielderExpr == nil {
+			return true
+		}
+
+		if !isCoroutine {
+			fmt.Printf("%s: not replacing blocking call in '%s' because it isn't a coroutine. Functions must yield or be marked with '//cogo:coroutine' to be fixed\n", fset.Position(exprStmt.Pos()), funcDecl.Name.Name)
+			return false
+		}
+
+		yieldCall := &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   ast.NewIdent(coroutineParamName),
+				Sel: ast.NewIdent("YieldTo"),
+			},
+			Args: []ast.Expr{yielderExpr},
+		}
+
+		setCallPos(yieldCall, exprStmt.Pos(), exprStmt.End())
+		if yielderCall, ok := yielderExpr.(*ast.CallExpr); ok {
+			setCallPos(yielderCall, exprStmt.Pos(), exprStmt.End())
+		}
+
+		newStmt := &ast.ExprStmt{X: yieldCall}
+
+		fmt.Printf("%s: replacing blocking call in coroutine '%s' with '%s'\n", fset.Position(exprStmt.Pos()), funcDecl.Name.Name, nodeToStr(fset, newStmt))
+		c.Replace(newStmt)
+		f.fixCount++
+		return false
+	}, nil)
+
+	return false
+}
+
+// getYielderForBlockingExpr returns an expression creating a yielder that is the cooperative
+// equivalent of the blocking expr, or nil if expr isn't a known blocking call
+func (f *fixer) getYielderForBlockingExpr(expr ast.Expr) ast.Expr {
+
+	// Bare channel receive: '<-ch'
+	if unaryExpr, ok := expr.(*ast.UnaryExpr); ok {
+
+		if unaryExpr.Op != token.ARROW {
+			return nil
+		}
+
+		return createSelFuncCallExpr("cogo", "NewChanReceiver", unaryExpr.X)
+	}
+
+	callExpr, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+
+	selExpr, ok := callExpr.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+
+	fn, ok := f.p.typesInfo.Uses[selExpr.Sel].(*types.Func)
+	if !ok {
+		return nil
+	}
+
+	switch fn.FullName() {
+	case "time.Sleep":
+		return createSelFuncCallExpr("cogo", "NewSleeper", callExpr.Args[0])
+
+	case "(*sync.WaitGroup).Wait":
+
+		// Wait might be promoted from an embedded WaitGroup, like 'jobs.Wait()', which we select the WaitGroup of by
+		// following the embedded fields the method was found through, like 'jobs.WaitGroup'
+		wgExpr, wgType := selExpr.X, f.p.typesInfo.TypeOf(selExpr.X)
+		embeddingPath := f.p.typesInfo.Selections[selExpr].Index()
+		for _, fieldIndex := range embeddingPath[:len(embeddingPath)-1] {
+
+			field := getStructType(wgType).Field(fieldIndex)
+			wgExpr = &ast.SelectorExpr{
+				X:   wgExpr,
+				Sel: &ast.Ident{NamePos: selExpr.Sel.Pos(), Name: field.Name()},
+			}
+			wgType = field.Type()
+		}
+
+		// The yielder needs a pointer, so take the address of WaitGroup values
+		if _, isPtr := wgType.(*types.Pointer); !isPtr {
+			wgExpr = &ast.UnaryExpr{
+				OpPos: selExpr.X.Pos(),
+				Op:    token.AND,
+				X:     wgExpr,
+			}
+		}
+
+		return createSelFuncCallExpr("cogo", "NewWaitGroupWaiter", wgExpr)
+	}
+
+	return nil
+}
+
+// getStructType returns the struct type of t, or of what t points to
+func getStructType(t types.Type) *types.Struct {
+
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+
+	return t.Underlying().(*types.Struct)
+}
+
+// setCallPos places a generated call like 'c.YieldTo(...)' over the code it replaces, since without
+// positions the comments that follow it would be printed inside of it
+func setCallPos(callExpr *ast.CallExpr, pos, end token.Pos) {
+
+	if selExpr, ok := callExpr.Fun.(*ast.SelectorExpr); ok {
+
+		if ident, ok := selExpr.X.(*ast.Ident); ok {
+			ident.NamePos = pos
+		}
+
+		selExpr.Sel.NamePos = pos
+	}
+
+	callExpr.Lparen = pos
+	callExpr.Rparen = end - 1
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixBlockingCalls(t *testing.T) {
+
+	dir := copyTestPkg(t, "fix")
+	pkg := loadTestPkg(t, dir)
+	fixPkgBlockingCalls(pkg, newYieldMacroFinder(pkg.Fset), false)
+
+	src, err := os.ReadFile(filepath.Join(dir, "fix.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"c.YieldTo(cogo.NewSleeper(time.Millisecond))",
+		"case <-c.In:",
+		"c.YieldTo(cogo.NewChanReceiver(c.In))",
+		"func sleep(c *cogo.Coroutine[chan int, int], d time.Duration) {\n\ttime.Sleep(d)\n}",
+		"c.YieldTo(cogo.NewWaitGroupWaiter(&c.In.jobs.WaitGroup))",
+		"c.YieldTo(cogo.NewWaitGroupWaiter(&c.In.jobs.WaitGroup))\n\tc.YieldTo(cogo.NewWaitGroupWaiter(&c.In.jobs.WaitGroup))",
+	}
+
+	for _, s := range expected {
+		if !strings.Contains(string(src), s) {
+			t.Fatalf("expected fixed file to contain '%s', but got:\n%s", s, src)
+		}
+	}
+
+	// The fixed package must still compile and generate
+	if pkg := loadTestPkg(t, dir); len(pkg.Errors) > 0 {
+		t.Fatalf("expected the fixed package to compile, but got %v", pkg.Errors)
+	}
+
+	if !genTestPkg(t, dir) {
+		t.Fatalf("expected the fixed package to generate valid code")
+	}
+}
+
+func TestFixNewTypeErrors(t *testing.T) {
+
+	// 'count_cogo' isn't generated yet, which is an error the file already has before fixing
+	const src = `package p
+
+import "github.com/bloeys/cogo/cogo"
+
+var counter = cogo.New(count_cogo, 0)
+
+func count(c *cogo.Coroutine[int, int]) {
+	c.Yield(1)
+}
+`
+
+	dir := newTestDir(t, "fixerrs")
+	fName := filepath.Join(dir, "a.go")
+	writeTestFile(t, fName, src)
+	pkg := loadTestPkg(t, dir)
+
+	if typeErrs := getNewTypeErrors(pkg, pkg.GoFiles[0], []byte(src)); len(typeErrs) > 0 {
+		t.Fatalf("expected errors the file already had to be ignored, but got %v", typeErrs)
+	}
+
+	brokenSrc := strings.Replace(src, "c.Yield(1)", "c.Yield(missing)", 1)
+	typeErrs := getNewTypeErrors(pkg, pkg.GoFiles[0], []byte(brokenSrc))
+	if len(typeErrs) != 1 || !strings.Contains(typeErrs[0].Msg, "missing") {
+		t.Fatalf("expected the new error of the fixed code to be found, but got %v", typeErrs)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Transition is a possible move of a coroutine from one yield point to another
+type Transition struct {
+	From token.Pos
+	To   token.Pos
+}
+
+// getTransitions walks the (not yet generated) body of a coroutine and returns the transitions between its yields.
+// This is an approximation of the real control flow: every branch is assumed to be possibly taken, and loops are assumed to run
+// zero or more times. The start and end of the function are used as the entry and exit points
+func (p *processor) getTransitions(funcDecl *ast.FuncDecl, coroutineParamName string) (transitions []Transition) {
+
+	seen := map[Transition]bool{}
+	addTransitions := func(froms []token.Pos, to token.Pos) {
+
+		for _, from := range froms {
+
+			t := Transition{From: from, To: to}
+			if !seen[t] {
+				seen[t] = true
+				transitions = append(transitions, t)
+			}
+		}
+	}
+
+	var flow func(stmts []ast.Stmt, preds []token.Pos) []token.Pos
+	flowStmt := func(stmt ast.Stmt, preds []token.Pos) []token.Pos {
+
+		if stmt == nil {
+			return preds
+		}
+
+		return flow([]ast.Stmt{stmt}, preds)
+	}
+
+	flow = func(stmts []ast.Stmt, preds []token.Pos) []token.Pos {
+
+		for _, stmt := range stmts {
+
+			if yieldFuncName, _ := p.getYieldFromStmt(stmt, coroutineParamName); yieldFuncName != "" {
+				addTransitions(preds, stmt.Pos())
+				preds = []token.Pos{stmt.Pos()}
+				continue
+			}
+
+			switch s := stmt.(type) {
+			case *ast.ReturnStmt:
+				addTransitions(preds, funcDecl.End())
+				preds = nil
+
+			case *ast.BlockStmt:
+				preds = flow(s.List, preds)
+
+			case *ast.LabeledStmt:
+				preds = flowStmt(s.Stmt, preds)
+
+			case *ast.IfStmt:
+				bodyPreds := flow(s.Body.List, preds)
+				preds = unionPositions(bodyPreds, flowStmt(s.Else, preds))
+
+			case *ast.ForStmt:
+				preds = flowLoop(s.Body, preds, flow)
+
+			case *ast.RangeStmt:
+				preds = flowLoop(s.Body, preds, flow)
+
+			case *ast.SwitchStmt:
+				preds = flowClauses(s.Body, preds, flow)
+
+			case *ast.TypeSwitchStmt:
+				preds = flowClauses(s.Body, preds, flow)
+
+			case *ast.SelectStmt:
+				preds = flowClauses(s.Body, preds, flow)
+			}
+		}
+
+		return preds
+	}
+
+	preds := flow(funcDecl.Body.List, []token.Pos{funcDecl.Pos()})
+	addTransitions(preds, funcDecl.End())
+	return transitions
+}
+
+func flowLoop(body *ast.BlockStmt, preds []token.Pos, flow func([]ast.Stmt, []token.Pos) []token.Pos) []token.Pos {
+
+	// The second pass adds the transitions from the end of the loop back to its start
+	bodyPreds := flow(body.List, preds)
+	bodyPreds = flow(body.List, unionPositions(preds, bodyPreds))
+	return unionPositions(preds, bodyPreds)
+}
+
+func flowClauses(body *ast.BlockStmt, preds []token.Pos, flow func([]ast.Stmt, []token.Pos) []token.Pos) []token.Pos {
+
+	outPreds := preds
+	for _, clause := range body.List {
+
+		switch c := clause.(type) {
+		case *ast.CaseClause:
+			outPreds = unionPositions(outPreds, flow(c.Body, preds))
+		case *ast.CommClause:
+			outPreds = unionPositions(outPreds, flow(c.Body, preds))
+		}
+	}
+
+	return outPreds
+}
+
+func unionPositions(a, b []token.Pos) []token.Pos {
+
+	out := make([]token.Pos, 0, len(a)+len(b))
+	out = append(out, a...)
+	for _, pos := range b {
+
+		found := false
+		for _, existing := range a {
+			if existing == pos {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, pos)
+		}
+	}
+
+	return out
+}
+
+// printGraphs writes a state machine diagram of every coroutine found by the processors.
+// Supported formats are 'dot' (Graphviz) and 'mermaid'
+func printGraphs(w io.Writer, processors []*processor, format string) {
+
+	if format != "dot" && format != "mermaid" {
+		panic("Unknown graph format '" + format + "'. Supported formats are 'dot' and 'mermaid'")
+	}
+
+	for _, p := range processors {
+		for _, c := range p.Coroutines {
+
+			if format == "dot" {
+				p.writeDotGraph(w, c)
+			} else {
+				p.writeMermaidGraph(w, c)
+			}
+		}
+	}
+}
+
+// getYieldPointDesc returns a short description of a yield point like 'State 3: YieldTo *cogo.Sleeper (demo.go:36)'
+func (p *processor) getYieldPointDesc(yp *YieldPoint) string {
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "State %d", yp.State)
+	if yp.Name != "" {
+		fmt.Fprintf(sb, " (%s)", yp.Name)
+	}
+
+	fmt.Fprintf(sb, ": %s", yp.Kind)
+	if yp.YielderType != "" {
+		fmt.Fprintf(sb, " %s", yp.YielderType)
+	}
+
+	fmt.Fprintf(sb, " (%s)", p.getShortPos(yp.Pos))
+	return sb.String()
+}
+
+// getShortPos returns a position in the style of 'demo.go:36'
+func (p *processor) getShortPos(pos token.Pos) string {
+	position := p.fset.Position(pos)
+	return fmt.Sprintf("%s:%d", filepath.Base(position.Filename), position.Line)
+}
+
+func (c *CoroutineInfo) getYieldPoint(pos token.Pos) *YieldPoint {
+
+	for _, yp := range c.YieldPoints {
+		if yp.Pos == pos {
+			return yp
+		}
+	}
+
+	return nil
+}
+
+// getYieldPointNodeName returns the graph node name of the yield point at pos, or an empty string
+// if there is none (e.g. the yield is in a construct the generator doesn't support)
+func (c *CoroutineInfo) getYieldPointNodeName(pos token.Pos) string {
+
+	yp := c.getYieldPoint(pos)
+	if yp == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("state_%d", yp.State)
+}
+
+func (p *processor) writeDotGraph(w io.Writer, c *CoroutineInfo) {
+
+	getNodeName := func(pos token.Pos) string {
+
+		switch pos {
+		case c.Decl.Pos():
+			return "start"
+		case c.Decl.End():
+			return "done"
+		}
+
+		return c.getYieldPointNodeName(pos)
+	}
+
+	fmt.Fprintf(w, "digraph %q {\n", c.Decl.Name.Name)
+	fmt.Fprintf(w, "\tnode [shape=box];\n")
+	fmt.Fprintf(w, "\tstart [shape=circle, label=%q];\n", "start\n"+p.getShortPos(c.Decl.Pos()))
+	fmt.Fprintf(w, "\tdone [shape=doublecircle, label=\"done\"];\n")
+	for _, yp := range c.YieldPoints {
+		fmt.Fprintf(w, "\t%s [label=%q];\n", getNodeName(yp.Pos), p.getYieldPointDesc(yp))
+	}
+
+	for _, t := range c.Transitions {
+
+		from, to := getNodeName(t.From), getNodeName(t.To)
+		if from != "" && to != "" {
+			fmt.Fprintf(w, "\t%s -> %s;\n", from, to)
+		}
+	}
+
+	fmt.Fprintf(w, "}\n\n")
+}
+
+func (p *processor) writeMermaidGraph(w io.Writer, c *CoroutineInfo) {
+
+	// Mermaid uses '[*]' for both the start and end states
+	getNodeName := func(pos token.Pos) string {
+
+		if pos == c.Decl.Pos() || pos == c.Decl.End() {
+			return "[*]"
+		}
+
+		return c.getYieldPointNodeName(pos)
+	}
+
+	fmt.Fprintf(w, "---\ntitle: %s\n---\n", c.Decl.Name.Name)
+	fmt.Fprintf(w, "stateDiagram-v2\n")
+	for _, yp := range c.YieldPoints {
+		fmt.Fprintf(w, "\tstate \"%s\" as %s\n", strings.ReplaceAll(p.getYieldPointDesc(yp), "\"", "'"), getNodeName(yp.Pos))
+	}
+
+	for _, t := range c.Transitions {
+
+		from, to := getNodeName(t.From), getNodeName(t.To)
+		if from != "" && to != "" {
+			fmt.Fprintf(w, "\t%s --> %s\n", from, to)
+		}
+	}
+
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGraphs compares the graphs of testdata/graph, which has a coroutine with an if/else, a loop and a return,
+// with the expected graphs in testdata/graph.dot.golden and testdata/graph.mmd.golden
+func TestGraphs(t *testing.T) {
+
+	processors := []*processor{loadTestCoroutines(t, copyTestPkg(t, "graph"))}
+	for _, test := range []struct {
+		format     string
+		goldenName string
+	}{
+		{"dot", "graph.dot.golden"},
+		{"mermaid", "graph.mmd.golden"},
+	} {
+
+		expected, err := os.ReadFile(filepath.Join("testdata", test.goldenName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb := &strings.Builder{}
+		printGraphs(sb, processors, test.format)
+		if sb.String() != string(expected) {
+			t.Fatalf("expected the %s graph\n%s\nbut got\n%s", test.format, expected, sb.String())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadCoroutines loads the packages matching patterns and runs the generator on them without writing
+// anything, returning one processor per package holding the information about its coroutines
+func loadCoroutines(cwd string, patterns []string) (processors []*processor) {
+
+	pkgs, err := packages.Load(&packages.Config{
+		Dir:   cwd,
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Tests: false,
+	}, patterns...)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(pkgs) == 0 {
+		return nil
+	}
+
+	macros := newYieldMacroFinder(pkgs[0].Fset)
+	for _, pkg := range pkgs {
+		processors = append(processors, findPkgCoroutines(pkg, macros))
+	}
+
+	return processors
+}
+
+// findPkgCoroutines runs the generator on pkg without writing anything, and returns the processor holding its coroutines
+func findPkgCoroutines(pkg *packages.Package, macros *yieldMacroFinder) *processor {
+
+	p := newProcessor(pkg, macros)
+	p.srcHashes = getSrcHashes(readPkgSrcs(pkg.GoFiles))
+	for _, synFile := range pkg.Syntax {
+
+		if isCogoFile(pkg.Fset.File(synFile.Pos()).Name()) || fileIsIgnored(pkg.Fset, synFile) {
+			continue
+		}
+
+		p.fileStateDirectives = getStateDirectives(pkg.Fset, synFile)
+		astutil.Apply(synFile, p.nodeProcessor, nil)
+		p.funcDeclsToWrite = p.funcDeclsToWrite[:0]
+	}
+
+	return p
+}
+
+// printCoroutineList prints every coroutine found by the processors, along with its types,
+// number of yield points, and the status of its generated file
+func printCoroutineList(w io.Writer, cwd string, processors []*processor) {
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COROUTINE\tPOSITION\tIN\tOUT\tYIELDS\tGENERATED")
+	for _, p := range processors {
+		for _, c := range p.Coroutines {
+
+			inType, outType := p.getCoroutineTypes(c)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n",
+				c.Decl.Name.Name,
+				getRelPath(cwd, p.fset.Position(c.Decl.Pos()).String()),
+				inType,
+				outType,
+				len(c.YieldPoints),
+				p.getGenFileStatus(c),
+			)
+		}
+	}
+
+	tw.Flush()
+}
+
+// explainCoroutine prints, for every coroutine called funcName, which source line each state value suspends at.
+// An error is returned if there is no such coroutine
+func explainCoroutine(w io.Writer, cwd, funcName string, processors []*processor) error {
+
+	found := false
+	for _, p := range processors {
+		for _, c := range p.Coroutines {
+
+			if c.Decl.Name.Name != funcName {
+				continue
+			}
+
+			found = true
+			inType, outType := p.getCoroutineTypes(c)
+			fmt.Fprintf(w, "%s (%s) -> %s\n", funcName, getRelPath(cwd, p.fset.Position(c.Decl.Pos()).String()), c.GenName)
+			fmt.Fprintf(w, "In: %s, Out: %s\n\n", inType, outType)
+
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "STATE\tNAME\tKIND\tYIELDER\tPOSITION\tLABEL")
+			fmt.Fprintf(tw, "0\t\t\t\t%s\t(start)\n", getRelPath(cwd, p.fset.Position(c.Decl.Pos()).String()))
+			for _, yp := range c.YieldPoints {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+					yp.State,
+					yp.Name,
+					yp.Kind,
+					yp.YielderType,
+					getRelPath(cwd, p.fset.Position(yp.Pos).String()),
+					yp.LblName,
+				)
+			}
+			fmt.Fprintf(tw, "-1\t\t\t\t\t(done)\n")
+			tw.Flush()
+			fmt.Fprintln(w)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no coroutine named '%s' was found", funcName)
+	}
+
+	return nil
+}
+
+// getCoroutineTypes returns the In and Out types of the coroutine
+func (p *processor) getCoroutineTypes(c *CoroutineInfo) (inType, outType string) {
+
+	for _, field := range c.Decl.Type.Params.List {
+		for _, name := range field.Names {
+
+			if name.Name != c.ParamName {
+				continue
+			}
+
+			ptr, ok := p.typesInfo.TypeOf(field.Type).(*types.Pointer)
+			if !ok {
+				break
+			}
+
+			named, ok := unalias(ptr.Elem()).(*types.Named)
+			if !ok || named.TypeArgs().Len() != 2 {
+				break
+			}
+
+			return p.typeToStr(named.TypeArgs().At(0)), p.typeToStr(named.TypeArgs().At(1))
+		}
+	}
+
+	return "?", "?"
+}
+
+// getGenFileStatus returns whether the generated file of the coroutine is 'current', 'outdated' or 'missing'
+func (p *processor) getGenFileStatus(c *CoroutineInfo) string {
+
+	srcFName := p.fset.Position(c.Decl.Pos()).Filename
+	genSrcHash, exists := readGenFileHash(getCogoFileName(srcFName))
+	if !exists {
+		return "missing"
+	}
+
+	if genSrcHash != p.srcHashes[srcFName] {
+		return "outdated"
+	}
+
+	return "current"
+}
+
+func getRelPath(cwd, path string) string {
+
+	relPath, err := filepath.Rel(cwd, path)
+	if err != nil {
+		return path
+	}
+
+	return relPath
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestCoroutines returns the processor holding the coroutines of the package in dir
+func loadTestCoroutines(t *testing.T, dir string) *processor {
+
+	pkg := loadTestPkg(t, dir)
+	return findPkgCoroutines(pkg, newYieldMacroFinder(pkg.Fset))
+}
+
+func TestPrintCoroutineList(t *testing.T) {
+
+	dir := copyTestPkg(t, "inspect")
+	if !genTestPkg(t, dir) {
+		t.Fatalf("expected the package to generate valid code")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() string {
+		sb := &strings.Builder{}
+		printCoroutineList(sb, absDir, []*processor{loadTestCoroutines(t, dir)})
+		return sb.String()
+	}
+
+	expected := []string{
+		"COROUTINE  POSITION  IN    OUT     YIELDS  GENERATED",
+		"count      a.go:9:1  int   string  3       current",
+		"wait       b.go:5:1  bool  int     1       current",
+	}
+
+	if out := list(); out != strings.Join(expected, "\n")+"\n" {
+		t.Fatalf("expected the list\n%s\nbut got\n%s", strings.Join(expected, "\n"), out)
+	}
+
+	// Changing any file of the package makes every generated file outdated
+	err = os.Remove(filepath.Join(dir, "b.cogo.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aFName := filepath.Join(dir, "a.go")
+	aSrc, err := os.ReadFile(aFName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, aFName, string(aSrc)+"\n// changed\n")
+
+	out := list()
+	if !strings.Contains(out, "3       outdated") || !strings.Contains(out, "1       missing") {
+		t.Fatalf("expected count to be outdated and wait to be missing, but got\n%s", out)
+	}
+}
+
+func TestExplainCoroutine(t *testing.T) {
+
+	dir := copyTestPkg(t, "inspect")
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processors := []*processor{loadTestCoroutines(t, dir)}
+	sb := &strings.Builder{}
+	err = explainCoroutine(sb, absDir, "count", processors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"count (a.go:9:1) -> count_cogo",
+		"In: int, Out: string",
+		"",
+		"STATE  NAME      KIND     YIELDER        POSITION   LABEL",
+		"0                                        a.go:9:1   (start)",
+		"1                Yield                   a.go:11:2  cogo_1",
+		"7      sleeping  YieldTo  *cogo.Sleeper  a.go:12:2  cogo_2",
+		"2                Yield                   a.go:13:2  cogo_3",
+		"-1                                                  (done)",
+	}
+
+	if out := sb.String(); out != strings.Join(expected, "\n")+"\n\n" {
+		t.Fatalf("expected\n%s\nbut got\n%s", strings.Join(expected, "\n"), out)
+	}
+
+	err = explainCoroutine(sb, absDir, "missing", processors)
+	if err == nil || !strings.Contains(err.Error(), "no coroutine named 'missing'") {
+		t.Fatalf("expected an error for a coroutine that doesn't exist, but got '%v'", err)
+	}
+}
@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// lowerer turns the body of a coroutine into a flat state machine.
+//
+// Every statement that contains a yield (blocks, ifs and for loops) is flattened into the top level of the function
+// using labels and gotos, so that every resume label is reachable from a single switch at the start of the function.
+// This makes resuming a coroutine one switch and one goto no matter how deeply the yield is nested.
+//
+// Because goto can't jump over variable declarations, code between labels that declares variables is wrapped in its own block.
+// Variables used across labels without a yield in between (like one checked by every condition of an else if chain) are
+// declared at the top of the function instead. Variables don't keep their values across yields anyway, so the variables
+// this rejects were already broken
+type lowerer struct {
+	p         *processor
+	coroutine *CoroutineInfo
+	paramName string
+	loops     []*loopLowering
+	gotoLbls  map[string]bool
+	scopeEnds map[ast.Stmt]bool
+}
+
+// loopLowering holds the labels that break and continue statements of a flattened loop jump to
+type loopLowering struct {
+	userLbl     string
+	breakLbl    string
+	continueLbl string
+}
+
+// lowerCoroutine replaces the body of the coroutine funcDecl with its state machine
+func (p *processor) lowerCoroutine(funcDecl *ast.FuncDecl, coroutineParamName string) {
+
+	l := &lowerer{
+		p:         p,
+		coroutine: p.currCoroutine(),
+		paramName: coroutineParamName,
+		gotoLbls:  map[string]bool{},
+		scopeEnds: map[ast.Stmt]bool{},
+	}
+
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+
+		if branchStmt, ok := n.(*ast.BranchStmt); ok && branchStmt.Tok == token.GOTO {
+			l.gotoLbls[branchStmt.Label.Name] = true
+		}
+
+		return true
+	})
+
+	l.checkValueYieldUsage(funcDecl.Body)
+
+	// Mark the coroutine as done if we reach its end
+	stmts := l.removeUnusedLbls(l.lowerStmts(funcDecl.Body.List))
+	if !isTerminating(stmts) {
+		stmts = append(stmts, l.getMarkDoneStmt())
+	}
+
+	stmts, hoistedDecl := l.hoistVars(stmts)
+	stmts = l.wrapSegments(stmts)
+
+	dispatch := &ast.SwitchStmt{
+		Tag:  &ast.CallExpr{Fun: ast.NewIdent(coroutineParamName + ".State")},
+		Body: &ast.BlockStmt{},
+	}
+
+	for _, yp := range l.coroutine.YieldPoints {
+		dispatch.Body.List = append(dispatch.Body.List, getCaseWithStmts(
+			[]ast.Expr{ast.NewIdent(l.coroutine.getStateConstName(yp))},
+			[]ast.Stmt{newGotoStmt(yp.LblName)},
+		))
+	}
+
+	funcDecl.Body.List = stmts
+	if len(dispatch.Body.List) > 0 {
+		funcDecl.Body.List = insertIntoArr[ast.Stmt](funcDecl.Body.List, 0, dispatch)
+	}
+
+	if hoistedDecl != nil {
+		funcDecl.Body.List = insertIntoArr(funcDecl.Body.List, 0, hoistedDecl)
+	}
+}
+
+func (l *lowerer) lowerStmts(stmts []ast.Stmt) []ast.Stmt {
+
+	out := make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		out = append(out, l.lowerStmt(stmt)...)
+	}
+
+	return out
+}
+
+func (l *lowerer) lowerStmt(stmt ast.Stmt) []ast.Stmt {
+
+	if yieldFuncName, args := l.p.getYieldFromStmt(stmt, l.paramName); yieldFuncName != "" {
+		return l.lowerYield(stmt, yieldFuncName, args)
+	}
+
+	if !l.p.usesCogo(stmt, l.paramName) {
+		return []ast.Stmt{l.rewriteBranches(stmt)}
+	}
+
+	var unsupported string
+	switch s := stmt.(type) {
+	case *ast.BlockStmt:
+		return l.lowerScope(s.List)
+	case *ast.LabeledStmt:
+		return l.lowerLabeled(s)
+	case *ast.IfStmt:
+		return l.lowerIf(s)
+	case *ast.ForStmt:
+		return l.lowerFor(s, "")
+	case *ast.RangeStmt:
+		unsupported = "range loops"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		unsupported = "switch statements"
+	case *ast.SelectStmt:
+		unsupported = "select statements"
+	default:
+		unsupported = "this kind of statement"
+	}
+
+	panic(fmt.Sprintf("%s: yields inside %s are not supported in coroutine '%s'. Please use 'if' and 'for' instead", l.p.fset.Position(stmt.Pos()), unsupported, l.coroutine.Decl.Name.Name))
+}
+
+// lowerYield replaces a yield with a block that saves the state and returns, followed by the label we resume at
+func (l *lowerer) lowerYield(yieldStmt ast.Stmt, yieldFuncName string, yieldArgs []ast.Expr) []ast.Stmt {
+
+	yieldPoint := l.coroutine.addYieldPoint(yieldStmt, yieldFuncName)
+	yieldPoint.LblName = l.newLbl(yieldStmt.Pos())
+
+	state := ast.NewIdent(l.coroutine.getStateConstName(yieldPoint))
+	yieldBlock := &ast.BlockStmt{}
+
+	suspendFunc := ast.NewIdent(l.paramName + "." + suspendFuncNames[yieldFuncName])
+	switch yieldFuncName {
+	case "YieldTo", "YieldToErr":
+		yieldBlock.List = append(yieldBlock.List, &ast.ExprStmt{
+			X: &ast.CallExpr{
+				Fun:  suspendFunc,
+				Args: []ast.Expr{state, yieldArgs[0]},
+			},
+		})
+		yieldPoint.YielderType = l.p.typeToStr(l.p.typesInfo.TypeOf(yieldArgs[0]))
+
+	default:
+		yieldBlock.List = append(yieldBlock.List, &ast.ExprStmt{
+			X: &ast.CallExpr{
+				Fun:  suspendFunc,
+				Args: []ast.Expr{state},
+			},
+		})
+
+		if yieldFuncName != "YieldNone" {
+			yieldBlock.List = append(yieldBlock.List, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(l.paramName + ".Out")},
+				Tok: token.ASSIGN,
+				Rhs: yieldArgs,
+			})
+		}
+	}
+
+	yieldBlock.List = append(yieldBlock.List, &ast.ReturnStmt{})
+	out := []ast.Stmt{yieldBlock, newLblStmt(yieldPoint.LblName)}
+
+	// After resuming, 'v := c.YieldRecv(x)' gets the input the coroutine was resumed with, and
+	// 'err := c.YieldErr(x)' gets the error it was resumed with
+	if assignStmt, ok := yieldStmt.(*ast.AssignStmt); ok {
+
+		value := ast.Expr(ast.NewIdent(l.paramName + ".In"))
+		if yieldFuncName != "YieldRecv" {
+			value = &ast.CallExpr{Fun: ast.NewIdent(l.paramName + ".ResumeErr")}
+		}
+
+		out = append(out, &ast.AssignStmt{
+			Lhs: assignStmt.Lhs,
+			Tok: assignStmt.Tok,
+			Rhs: []ast.Expr{value},
+		})
+	}
+
+	return out
+}
+
+// checkValueYieldUsage panics if a yield with a value (like 'YieldRecv') is used anywhere other than as 'v := c.YieldRecv(x)',
+// 'v = c.YieldRecv(x)' or on its own, since those are the only forms we can suspend at
+func (l *lowerer) checkValueYieldUsage(body *ast.BlockStmt) {
+
+	allowedCalls := map[ast.Expr]bool{}
+	ast.Inspect(body, func(n ast.Node) bool {
+
+		switch s := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ExprStmt:
+			allowedCalls[s.X] = true
+		case *ast.AssignStmt:
+			if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+				allowedCalls[s.Rhs[0]] = true
+			}
+		}
+
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok || allowedCalls[callExpr] {
+			return true
+		}
+
+		selExpr, ok := callExpr.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		for _, name := range valueYieldFuncNames {
+			if selExprIs(selExpr, l.paramName, name) {
+				panic(fmt.Sprintf("%s: '%s' can only be used as 'v := %s.%s(x)' or 'v = %s.%s(x)' in coroutine '%s'", l.p.fset.Position(callExpr.Pos()), name, l.paramName, name, l.paramName, name, l.coroutine.Decl.Name.Name))
+			}
+		}
+
+		return true
+	})
+}
+
+// lowerScope flattens the statements of a block. The end of the block is marked so that
+// variables declared in it don't clash with ones declared after it
+func (l *lowerer) lowerScope(stmts []ast.Stmt) []ast.Stmt {
+
+	l.checkShadowing(stmts)
+
+	scopeEnd := &ast.EmptyStmt{Implicit: true}
+	l.scopeEnds[scopeEnd] = true
+	return append(l.lowerStmts(stmts), scopeEnd)
+}
+
+func (l *lowerer) lowerLabeled(s *ast.LabeledStmt) []ast.Stmt {
+
+	// Breaks and continues to a flattened loop are turned into gotos, so its label is only kept if something jumps to it
+	if forStmt, ok := s.Stmt.(*ast.ForStmt); ok {
+
+		var out []ast.Stmt
+		if l.gotoLbls[s.Label.Name] {
+			out = append(out, &ast.LabeledStmt{Label: s.Label, Stmt: &ast.EmptyStmt{Implicit: true}})
+		}
+
+		return append(out, l.lowerFor(forStmt, s.Label.Name)...)
+	}
+
+	return append([]ast.Stmt{&ast.LabeledStmt{Label: s.Label, Stmt: &ast.EmptyStmt{Implicit: true}}}, l.lowerStmt(s.Stmt)...)
+}
+
+// lowerIf flattens the branches of an if statement that have yields. Branches without yields stay inside the if
+func (l *lowerer) lowerIf(s *ast.IfStmt) []ast.Stmt {
+
+	// The init statement can be a yield, like 'if err := c.YieldErr(x); err != nil {'
+	var out []ast.Stmt
+	if s.Init != nil {
+		l.checkShadowing([]ast.Stmt{s.Init})
+		out = append(out, l.lowerStmt(s.Init)...)
+	}
+
+	endLbl := l.newLbl(s.Pos())
+	thenYields := l.p.usesCogo(s.Body, l.paramName)
+	elseYields := s.Else != nil && l.p.usesCogo(s.Else, l.paramName)
+	switch {
+	case !thenYields:
+
+		thenStmts := l.rewriteBranchesList(s.Body.List)
+		if !isTerminating(thenStmts) {
+			thenStmts = append(thenStmts, newGotoStmt(endLbl))
+		}
+
+		out = append(out, &ast.IfStmt{Cond: s.Cond, Body: &ast.BlockStmt{List: thenStmts}})
+		out = append(out, l.lowerElse(s.Else)...)
+
+	case !elseYields:
+
+		var elseStmts []ast.Stmt
+		switch e := s.Else.(type) {
+		case *ast.BlockStmt:
+			elseStmts = l.rewriteBranchesList(e.List)
+		case *ast.IfStmt:
+			elseStmts = []ast.Stmt{l.rewriteBranches(e)}
+		}
+
+		if !isTerminating(elseStmts) {
+			elseStmts = append(elseStmts, newGotoStmt(endLbl))
+		}
+
+		out = append(out, &ast.IfStmt{Cond: negateExpr(s.Cond), Body: &ast.BlockStmt{List: elseStmts}})
+		out = append(out, l.lowerScope(s.Body.List)...)
+
+	default:
+
+		elseLbl := l.newLbl(s.Else.Pos())
+		out = append(out, &ast.IfStmt{Cond: negateExpr(s.Cond), Body: &ast.BlockStmt{List: []ast.Stmt{newGotoStmt(elseLbl)}}})
+
+		thenStmts := l.lowerScope(s.Body.List)
+		out = append(out, thenStmts...)
+		if !isTerminating(thenStmts) {
+			out = append(out, newGotoStmt(endLbl))
+		}
+
+		out = append(out, newLblStmt(elseLbl))
+		out = append(out, l.lowerElse(s.Else)...)
+	}
+
+	// The scope end is for variables declared in the init statement
+	scopeEnd := &ast.EmptyStmt{Implicit: true}
+	l.scopeEnds[scopeEnd] = true
+	return append(out, newLblStmt(endLbl), scopeEnd)
+}
+
+func (l *lowerer) lowerElse(elseStmt ast.Stmt) []ast.Stmt {
+
+	// An if without an else is only flattened when its init statement yields
+	if elseStmt == nil {
+		return nil
+	}
+
+	if ifStmt, ok := elseStmt.(*ast.IfStmt); ok {
+		return l.lowerIf(ifStmt)
+	}
+
+	return l.lowerScope(elseStmt.(*ast.BlockStmt).List)
+}
+
+// lowerFor flattens a for loop with yields into a condition check at a label, the loop body, and a goto back to the condition
+func (l *lowerer) lowerFor(s *ast.ForStmt, userLbl string) []ast.Stmt {
+
+	// The init statement can be a yield, like 'if err := c.YieldErr(x); err != nil {'
+	var out []ast.Stmt
+	if s.Init != nil {
+		l.checkShadowing([]ast.Stmt{s.Init})
+		out = append(out, l.lowerStmt(s.Init)...)
+	}
+
+	condLbl := l.newLbl(s.Pos())
+	endLbl := l.newLbl(s.Pos())
+	continueLbl := condLbl
+	if s.Post != nil {
+		continueLbl = l.newLbl(s.Post.Pos())
+	}
+
+	out = append(out, newLblStmt(condLbl))
+	if s.Cond != nil {
+		out = append(out, &ast.IfStmt{Cond: negateExpr(s.Cond), Body: &ast.BlockStmt{List: []ast.Stmt{newGotoStmt(endLbl)}}})
+	}
+
+	l.loops = append(l.loops, &loopLowering{
+		userLbl:     userLbl,
+		breakLbl:    endLbl,
+		continueLbl: continueLbl,
+	})
+	body := l.lowerScope(s.Body.List)
+	l.loops = l.loops[:len(l.loops)-1]
+
+	out = append(out, body...)
+	if s.Post != nil {
+		out = append(out, newLblStmt(continueLbl))
+		out = append(out, l.lowerStmt(s.Post)...)
+	}
+
+	if s.Post != nil || !isTerminating(body) {
+		out = append(out, newGotoStmt(condLbl))
+	}
+
+	scopeEnd := &ast.EmptyStmt{Implicit: true}
+	l.scopeEnds[scopeEnd] = true
+	return append(out, newLblStmt(endLbl), scopeEnd)
+}
+
+func (l *lowerer) rewriteBranchesList(stmts []ast.Stmt) []ast.Stmt {
+
+	out := make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		out = append(out, l.rewriteBranches(stmt))
+	}
+
+	return out
+}
+
+// rewriteBranches updates a statement without yields for its new place in the state machine. Returns must mark the coroutine
+// as done, defers must only run once the coroutine is done, and breaks and continues that belong to a flattened loop become gotos
+func (l *lowerer) rewriteBranches(stmt ast.Stmt) ast.Stmt {
+
+	// Track the loops and switches between stmt and the branch, which is what unlabeled breaks and continues belong to
+	loopDepth := 0
+	breakableDepth := 0
+	return astutil.Apply(stmt, func(c *astutil.Cursor) bool {
+
+		switch n := c.Node().(type) {
+		case *ast.FuncLit:
+			return false
+
+		case *ast.ForStmt, *ast.RangeStmt:
+			loopDepth++
+			breakableDepth++
+
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			breakableDepth++
+
+		case *ast.DeferStmt:
+			c.Replace(l.lowerDefer(n))
+			return false
+
+		case *ast.ReturnStmt:
+			c.Replace(&ast.BlockStmt{
+				List: []ast.Stmt{l.getMarkDoneStmt(), n},
+			})
+
+		case *ast.BranchStmt:
+
+			var loop *loopLowering
+			switch {
+			case n.Label != nil:
+				loop = l.getLoopByUserLbl(n.Label.Name)
+			case n.Tok == token.BREAK && breakableDepth == 0, n.Tok == token.CONTINUE && loopDepth == 0:
+				if len(l.loops) > 0 {
+					loop = l.loops[len(l.loops)-1]
+				}
+			}
+
+			if loop == nil {
+				return true
+			}
+
+			gotoStmt := newGotoStmt(loop.continueLbl).(*ast.BranchStmt)
+			if n.Tok == token.BREAK {
+				gotoStmt.Label.Name = loop.breakLbl
+			}
+
+			// Keeping the position makes the printer keep the goto on the same line
+			gotoStmt.TokPos = n.TokPos
+			c.Replace(gotoStmt)
+		}
+
+		return true
+	}, func(c *astutil.Cursor) bool {
+
+		switch c.Node().(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			loopDepth--
+			breakableDepth--
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			breakableDepth--
+		}
+
+		return true
+	}).(ast.Stmt)
+}
+
+// lowerDefer turns 'defer f(x)' into 'c.OnDone(func() { f(x) })', since the function returns on every yield.
+// Like with defer, the function value and arguments are evaluated right away by storing them in variables
+func (l *lowerer) lowerDefer(s *ast.DeferStmt) ast.Stmt {
+
+	var names []ast.Expr
+	var values []ast.Expr
+	store := func(expr ast.Expr, name string) ast.Expr {
+
+		names = append(names, ast.NewIdent(name))
+		values = append(values, expr)
+		return ast.NewIdent(name)
+	}
+
+	call := &ast.CallExpr{
+		Fun:      s.Call.Fun,
+		Ellipsis: s.Call.Ellipsis,
+	}
+
+	// Functions and builtins are the same whenever they are evaluated, and builtins can't be stored in variables anyway
+	if !l.isFuncName(s.Call.Fun) {
+		call.Fun = store(s.Call.Fun, "cogo_defer_f")
+	}
+
+	// Constants are stored as is, since storing them in a variable would lose their untyped-ness
+	for i, arg := range s.Call.Args {
+
+		if tv, ok := l.p.typesInfo.Types[arg]; ok && (tv.Value != nil || tv.IsNil()) {
+			call.Args = append(call.Args, arg)
+			continue
+		}
+
+		call.Args = append(call.Args, store(arg, fmt.Sprintf("cogo_defer_arg%d", i)))
+	}
+
+	onDoneStmt := &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: ast.NewIdent(l.paramName + ".OnDone"),
+			Args: []ast.Expr{&ast.FuncLit{
+				Type: &ast.FuncType{Func: s.Defer, Params: &ast.FieldList{}},
+				// Positions on the line of the defer make the printer keep the function on one line
+				Body: &ast.BlockStmt{Lbrace: s.Defer, List: []ast.Stmt{&ast.ExprStmt{X: call}}, Rbrace: s.End()},
+			}},
+		},
+	}
+
+	if len(names) == 0 {
+		return onDoneStmt
+	}
+
+	return &ast.BlockStmt{
+		List: []ast.Stmt{
+			&ast.AssignStmt{Lhs: names, Tok: token.DEFINE, Rhs: values},
+			onDoneStmt,
+		},
+	}
+}
+
+// isFuncName returns true if expr names a function or a builtin, like 'f', 'close' or 'fmt.Println'
+func (l *lowerer) isFuncName(expr ast.Expr) bool {
+
+	var ident *ast.Ident
+	switch e := expr.(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		// Method values bind their receiver, so only package functions count
+		if _, isSelection := l.p.typesInfo.Selections[e]; isSelection {
+			return false
+		}
+
+		ident = e.Sel
+	default:
+		return false
+	}
+
+	switch l.p.typesInfo.Uses[ident].(type) {
+	case *types.Func, *types.Builtin:
+		return true
+	}
+
+	return false
+}
+
+func (l *lowerer) getLoopByUserLbl(userLbl string) *loopLowering {
+
+	for _, loop := range l.loops {
+		if loop.userLbl == userLbl {
+			return loop
+		}
+	}
+
+	return nil
+}
+
+// checkShadowing panics if a variable declared directly in stmts shadows another variable of the coroutine. Flattened blocks
+// lose their scope, so the two variables would end up being the same one
+func (l *lowerer) checkShadowing(stmts []ast.Stmt) {
+
+	decl := l.coroutine.Decl
+	for _, stmt := range stmts {
+		for _, ident := range getDeclaredVarIdents(stmt) {
+
+			obj, ok := l.p.typesInfo.Defs[ident].(*types.Var)
+			if !ok || obj.Parent() == nil || obj.Parent().Parent() == nil {
+				continue
+			}
+
+			_, shadowed := obj.Parent().Parent().LookupParent(ident.Name, ident.Pos())
+			if _, isVar := shadowed.(*types.Var); !isVar || shadowed.Pos() < decl.Pos() || shadowed.Pos() >= decl.End() {
+				continue
+			}
+
+			panic(fmt.Sprintf("%s: variable '%s' shadows the one declared at %s, which isn't supported in blocks with yields in coroutine '%s'. Please rename it", l.p.fset.Position(ident.Pos()), ident.Name, l.p.fset.Position(shadowed.Pos()), decl.Name.Name))
+		}
+	}
+}
+
+// removeUnusedLbls removes generated labels that nothing jumps to, since Go doesn't allow unused labels
+func (l *lowerer) removeUnusedLbls(stmts []ast.Stmt) []ast.Stmt {
+
+	usedLbls := map[string]bool{}
+	for _, yp := range l.coroutine.YieldPoints {
+		usedLbls[yp.LblName] = true
+	}
+
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+
+			if branchStmt, ok := n.(*ast.BranchStmt); ok && branchStmt.Label != nil {
+				usedLbls[branchStmt.Label.Name] = true
+			}
+
+			return true
+		})
+	}
+
+	out := stmts[:0]
+	for _, stmt := range stmts {
+
+		lblName := l.getGenLblName(stmt)
+		if lblName != "" && !usedLbls[lblName] {
+			delete(l.coroutine.LblOrigins, lblName)
+			continue
+		}
+
+		out = append(out, stmt)
+	}
+
+	return out
+}
+
+// hoistVars finds the variables declared between two generated labels that are used after another label, and moves
+// their declarations to a 'var' statement which is returned, while the original declarations become assignments.
+//
+// A variable is only hoisted if every way into the code using it (from the start of the function or from
+// a resume label) goes through its declaration. A variable used after a yield isn't hoisted, so it
+// keeps failing to compile instead of silently losing its value
+func (l *lowerer) hoistVars(stmts []ast.Stmt) (out []ast.Stmt, hoistedDecl ast.Stmt) {
+
+	// Segments are split like in wrapSegments, and segment 0 is where the function starts
+	segmentOf := make([]int, len(stmts))
+	lblSegments := map[string]int{}
+	segmentCount := 1
+	for i, stmt := range stmts {
+
+		if lblName := l.getGenLblName(stmt); lblName != "" {
+			lblSegments[lblName] = segmentCount
+			segmentCount++
+		} else if l.scopeEnds[stmt] {
+			segmentCount++
+		}
+
+		segmentOf[i] = segmentCount - 1
+	}
+
+	// A segment continues into the next one unless it ends with a return or goto, and into the segments of the labels it jumps to
+	nextSegments := make([][]int, segmentCount)
+	segmentStmts := make([][]ast.Stmt, segmentCount)
+	for i, stmt := range stmts {
+		segmentStmts[segmentOf[i]] = append(segmentStmts[segmentOf[i]], stmt)
+	}
+
+	for segment, segStmts := range segmentStmts {
+
+		if segment+1 < segmentCount && !isTerminating(segStmts) {
+			nextSegments[segment] = append(nextSegments[segment], segment+1)
+		}
+
+		for _, stmt := range segStmts {
+			ast.Inspect(stmt, func(n ast.Node) bool {
+
+				if _, ok := n.(*ast.FuncLit); ok {
+					return false
+				}
+
+				if branchStmt, ok := n.(*ast.BranchStmt); ok && branchStmt.Tok == token.GOTO {
+					if target, ok := lblSegments[branchStmt.Label.Name]; ok {
+						nextSegments[segment] = append(nextSegments[segment], target)
+					}
+				}
+
+				return true
+			})
+		}
+	}
+
+	entrySegments := []int{0}
+	for _, yp := range l.coroutine.YieldPoints {
+		entrySegments = append(entrySegments, lblSegments[yp.LblName])
+	}
+
+	declSegments := map[*types.Var]int{}
+	for i, stmt := range stmts {
+		for _, ident := range getDeclaredVarIdents(stmt) {
+			if v, ok := l.p.typesInfo.Defs[ident].(*types.Var); ok {
+				declSegments[v] = segmentOf[i]
+			}
+		}
+	}
+
+	useSegments := map[*types.Var][]int{}
+	for i, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			v, ok := l.p.typesInfo.Uses[ident].(*types.Var)
+			if declSegment, isDeclared := declSegments[v]; ok && isDeclared && declSegment != segmentOf[i] {
+				useSegments[v] = append(useSegments[v], segmentOf[i])
+			}
+
+			return true
+		})
+	}
+
+	isHoisted := map[*types.Var]bool{}
+	for v, uses := range useSegments {
+
+		reachable := getReachableSegments(nextSegments, entrySegments, declSegments[v])
+		isSafe := true
+		for _, segment := range uses {
+			isSafe = isSafe && !reachable[segment]
+		}
+
+		isHoisted[v] = isSafe
+	}
+
+	if len(isHoisted) == 0 {
+		return stmts, nil
+	}
+
+	// Statements that declare a hoisted variable become assignments, so every variable they declare is hoisted
+	var hoisted []*types.Var
+	out = make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+
+		var declared []*types.Var
+		hoistStmt := false
+		for _, ident := range getDeclaredVarIdents(stmt) {
+			if v, ok := l.p.typesInfo.Defs[ident].(*types.Var); ok {
+				declared = append(declared, v)
+				hoistStmt = hoistStmt || isHoisted[v]
+			}
+		}
+
+		if !hoistStmt {
+			out = append(out, stmt)
+			continue
+		}
+
+		hoisted = append(hoisted, declared...)
+		out = append(out, l.declToAssign(stmt)...)
+	}
+
+	return out, l.getHoistedDecl(hoisted, stmts)
+}
+
+// getReachableSegments returns the segments that can be reached from entrySegments without going through barrierSegment
+func getReachableSegments(nextSegments [][]int, entrySegments []int, barrierSegment int) (reachable map[int]bool) {
+
+	reachable = map[int]bool{}
+	toVisit := append([]int{}, entrySegments...)
+	for len(toVisit) > 0 {
+
+		segment := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if segment == barrierSegment || reachable[segment] {
+			continue
+		}
+
+		reachable[segment] = true
+		toVisit = append(toVisit, nextSegments[segment]...)
+	}
+
+	return reachable
+}
+
+// declToAssign turns a variable declaration like 'x := 1' or 'var x int' into assignments to the same variables
+func (l *lowerer) declToAssign(stmt ast.Stmt) []ast.Stmt {
+
+	if assignStmt, ok := stmt.(*ast.AssignStmt); ok {
+		assignStmt.Tok = token.ASSIGN
+		return []ast.Stmt{assignStmt}
+	}
+
+	var out []ast.Stmt
+	for _, spec := range stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl).Specs {
+
+		valueSpec := spec.(*ast.ValueSpec)
+		if len(valueSpec.Values) > 0 {
+			out = append(out, &ast.AssignStmt{Lhs: identsToExprs(valueSpec.Names), Tok: token.ASSIGN, Rhs: valueSpec.Values})
+			continue
+		}
+
+		// Without a value the variable is reset to its zero value, like a declaration would
+		for _, name := range valueSpec.Names {
+
+			zeroValue := &ast.StarExpr{
+				X: &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{l.parseType(l.p.typesInfo.Defs[name].Type())}},
+			}
+
+			out = append(out, &ast.AssignStmt{Lhs: []ast.Expr{name}, Tok: token.ASSIGN, Rhs: []ast.Expr{zeroValue}})
+		}
+	}
+
+	return out
+}
+
+// getHoistedDecl returns the declaration of the hoisted variables. Variables with the same name (declared in different
+// blocks) share one declaration if they have the same type
+func (l *lowerer) getHoistedDecl(hoisted []*types.Var, stmts []ast.Stmt) ast.Stmt {
+
+	decl := &ast.GenDecl{Tok: token.VAR}
+	declared := map[string]*types.Var{}
+	for _, v := range hoisted {
+
+		if v.Name() == "_" {
+			continue
+		}
+
+		if other, ok := declared[v.Name()]; ok {
+
+			if !types.Identical(v.Type(), other.Type()) {
+				panic(fmt.Sprintf("%s: variable '%s' has a different type than the one declared at %s, which isn't supported in blocks with yields in coroutine '%s'. Please rename it", l.p.fset.Position(v.Pos()), v.Name(), l.p.fset.Position(other.Pos()), l.coroutine.Decl.Name.Name))
+			}
+
+			continue
+		}
+
+		declared[v.Name()] = v
+		decl.Specs = append(decl.Specs, &ast.ValueSpec{
+			Names: []*ast.Ident{ast.NewIdent(v.Name())},
+			Type:  l.parseType(v.Type()),
+		})
+	}
+
+	// Names declared outside the coroutine that are used in it would be shadowed for the whole function
+	selIdents := map[*ast.Ident]bool{}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+
+			if selExpr, ok := n.(*ast.SelectorExpr); ok {
+				selIdents[selExpr.Sel] = true
+			}
+
+			ident, ok := n.(*ast.Ident)
+			if !ok || selIdents[ident] || declared[ident.Name] == nil {
+				return true
+			}
+
+			obj := l.p.typesInfo.Uses[ident]
+			if obj != nil && (obj.Pos() < l.coroutine.Decl.Pos() || obj.Pos() >= l.coroutine.Decl.End()) {
+				v := declared[ident.Name]
+				panic(fmt.Sprintf("%s: variable '%s' would hide the '%s' used at %s for all of coroutine '%s', since it's used across yields. Please rename it", l.p.fset.Position(v.Pos()), v.Name(), ident.Name, l.p.fset.Position(ident.Pos()), l.coroutine.Decl.Name.Name))
+			}
+
+			return true
+		})
+	}
+
+	return &ast.DeclStmt{Decl: decl}
+}
+
+func (l *lowerer) parseType(t types.Type) ast.Expr {
+
+	typeExpr, err := parser.ParseExpr(l.p.typeToStr(t))
+	if err != nil {
+		panic("Failed to parse type '" + l.p.typeToStr(t) + "'. Err: " + err.Error())
+	}
+
+	return typeExpr
+}
+
+func identsToExprs(idents []*ast.Ident) []ast.Expr {
+
+	exprs := make([]ast.Expr, len(idents))
+	for i, ident := range idents {
+		exprs[i] = ident
+	}
+
+	return exprs
+}
+
+// wrapSegments puts code between generated labels that declares variables into a block, so that gotos don't jump over the declarations.
+// Constants and types are left outside the block because they can be jumped over, and might be used after a yield
+func (l *lowerer) wrapSegments(stmts []ast.Stmt) []ast.Stmt {
+
+	out := make([]ast.Stmt, 0, len(stmts))
+	var segment []ast.Stmt
+	flushSegment := func(isLast bool) {
+
+		if isLast || !declaresVars(segment) {
+			out = append(out, segment...)
+			segment = nil
+			return
+		}
+
+		block := &ast.BlockStmt{}
+		for _, stmt := range segment {
+
+			if declStmt, ok := stmt.(*ast.DeclStmt); ok && declStmt.Decl.(*ast.GenDecl).Tok != token.VAR {
+				out = append(out, stmt)
+				continue
+			}
+
+			block.List = append(block.List, stmt)
+		}
+
+		out = append(out, block)
+		segment = nil
+	}
+
+	for _, stmt := range stmts {
+
+		if l.scopeEnds[stmt] {
+			flushSegment(false)
+			continue
+		}
+
+		if l.getGenLblName(stmt) != "" {
+			flushSegment(false)
+			out = append(out, stmt)
+			continue
+		}
+
+		segment = append(segment, stmt)
+	}
+
+	flushSegment(true)
+	return out
+}
+
+// getGenLblName returns the name of the label if stmt is a label made by the lowerer
+func (l *lowerer) getGenLblName(stmt ast.Stmt) string {
+
+	lblStmt, ok := stmt.(*ast.LabeledStmt)
+	if !ok {
+		return ""
+	}
+
+	if _, ok := l.coroutine.LblOrigins[lblStmt.Label.Name]; !ok {
+		return ""
+	}
+
+	return lblStmt.Label.Name
+}
+
+func (l *lowerer) newLbl(origin token.Pos) string {
+
+	l.coroutine.lastLblNum++
+	lblName := fmt.Sprintf("cogo_%d", l.coroutine.lastLblNum)
+	l.coroutine.LblOrigins[lblName] = origin
+	return lblName
+}
+
+func (l *lowerer) getMarkDoneStmt() ast.Stmt {
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{Fun: ast.NewIdent(l.paramName + ".MarkDone")},
+	}
+}
+
+func newLblStmt(lblName string) ast.Stmt {
+	return &ast.LabeledStmt{
+		Label: ast.NewIdent(lblName),
+		Stmt:  &ast.EmptyStmt{Implicit: true},
+	}
+}
+
+func newGotoStmt(lblName string) ast.Stmt {
+	return &ast.BranchStmt{
+		Tok:   token.GOTO,
+		Label: ast.NewIdent(lblName),
+	}
+}
+
+// negateExpr returns '!expr', without adding parentheses when they aren't needed
+func negateExpr(expr ast.Expr) ast.Expr {
+
+	switch e := expr.(type) {
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return e.X
+		}
+	case *ast.Ident, *ast.CallExpr, *ast.SelectorExpr, *ast.ParenExpr, *ast.IndexExpr:
+		return &ast.UnaryExpr{Op: token.NOT, X: expr}
+	}
+
+	return &ast.UnaryExpr{Op: token.NOT, X: &ast.ParenExpr{X: expr}}
+}
+
+// isTerminating returns true if the last statement never lets execution continue past it
+func isTerminating(stmts []ast.Stmt) bool {
+
+	// Empty statements (e.g. scope ends) don't run anything
+	for len(stmts) > 0 {
+
+		if _, ok := stmts[len(stmts)-1].(*ast.EmptyStmt); !ok {
+			break
+		}
+
+		stmts = stmts[:len(stmts)-1]
+	}
+
+	if len(stmts) == 0 {
+		return false
+	}
+
+	switch s := stmts[len(stmts)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return s.Tok != token.FALLTHROUGH
+	case *ast.BlockStmt:
+		return isTerminating(s.List)
+	}
+
+	return false
+}
+
+func getDeclaredVarIdents(stmt ast.Stmt) (idents []*ast.Ident) {
+
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+
+		if s.Tok != token.DEFINE {
+			return nil
+		}
+
+		for _, expr := range s.Lhs {
+			if ident, ok := expr.(*ast.Ident); ok {
+				idents = append(idents, ident)
+			}
+		}
+
+	case *ast.DeclStmt:
+
+		genDecl := s.Decl.(*ast.GenDecl)
+		if genDecl.Tok != token.VAR {
+			return nil
+		}
+
+		for _, spec := range genDecl.Specs {
+			idents = append(idents, spec.(*ast.ValueSpec).Names...)
+		}
+	}
+
+	return idents
+}
+
+func declaresVars(stmts []ast.Stmt) bool {
+
+	for _, stmt := range stmts {
+		if len(getDeclaredVarIdents(stmt)) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// coroutineSrcFmt is a file with a single coroutine, whose body is the format argument
+const coroutineSrcFmt = `package p
+
+import "github.com/bloeys/cogo/cogo"
+
+func f(c *cogo.Coroutine[int, int]) {
+	%s
+}
+`
+
+// TestLowering generates the coroutines of testdata/lower and runs its tests against the generated code
+func TestLowering(t *testing.T) {
+
+	dir := copyTestPkg(t, "lower")
+	if !genTestPkg(t, dir) {
+		t.Fatalf("expected the package to generate valid code")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "ignored.cogo.go")); err == nil {
+		t.Fatalf("expected nothing to be generated for an ignored file")
+	}
+
+	genSrc, err := os.ReadFile(filepath.Join(dir, "lower.cogo.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(genSrc), "ignoredFunc") {
+		t.Fatalf("expected nothing to be generated for an ignored function")
+	}
+
+	goTest(t, dir)
+}
+
+func TestLoweringUnsupported(t *testing.T) {
+
+	tests := []struct {
+		body string
+		msg  string
+	}{
+		{"switch c.Out {\ncase 0:\nc.Yield(1)\n}", "yields inside switch statements are not supported"},
+		{"for range []int{1} {\nc.Yield(1)\n}", "yields inside range loops are not supported"},
+		{"c.Yield(0)\nprintln(c.YieldRecv(1))", "'YieldRecv' can only be used as 'v := c.YieldRecv(x)'"},
+		{"x := 1\nif x > 0 {\nx := 2\nc.Yield(x)\n}", "variable 'x' shadows the one declared at"},
+		{"println(len(\"a\"))\nlen := 2\nif len > 1 {\nc.Yield(1)\n} else if len > 0 {\nc.Yield(2)\n}", "variable 'len' would hide the 'len' used at"},
+	}
+
+	for _, test := range tests {
+
+		dir := newTestDir(t, "unsupported")
+		writeTestFile(t, filepath.Join(dir, "a.go"), fmt.Sprintf(coroutineSrcFmt, test.body))
+
+		msg := expectPanic(t, func() { genTestPkg(t, dir) })
+		if !strings.Contains(msg, test.msg) {
+			t.Fatalf("expected generating\n%s\nto fail with '%s', but got '%s'", test.body, test.msg, msg)
+		}
+	}
+}
+
+func TestLoweringInvalidMacro(t *testing.T) {
+
+	dir := newTestDir(t, "macro")
+	src := fmt.Sprintf(coroutineSrcFmt, "wait(1)\nc.Yield(1)") + `
+//cogo:yield
+func wait(n int) int {
+	return n
+}
+`
+	writeTestFile(t, filepath.Join(dir, "a.go"), src)
+
+	msg := expectPanic(t, func() { genTestPkg(t, dir) })
+	if !strings.Contains(msg, "yield macro 'wait' must return exactly one value that implements cogo.Yielder") {
+		t.Fatalf("expected a macro that doesn't return a yielder to be rejected, but got '%s'", msg)
+	}
+}
+
+// TestLoweringInvalid checks that generated code that doesn't compile, like code using
+// a variable after a yield, is reported and not written
+func TestLoweringInvalid(t *testing.T) {
+
+	bodies := []string{
+		"x := 1\nc.Yield(1)\nprintln(x)",
+		"n := 3\nfor n > 0 {\nc.Yield(n)\nn--\n}",
+	}
+
+	for _, body := range bodies {
+
+		dir := newTestDir(t, "invalid")
+		writeTestFile(t, filepath.Join(dir, "a.go"), fmt.Sprintf(coroutineSrcFmt, body))
+
+		if genTestPkg(t, dir) {
+			t.Fatalf("expected generating\n%s\nto fail", body)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "a.cogo.go")); err == nil {
+			t.Fatalf("expected the invalid generated file of\n%s\nto not be written", body)
+		}
+	}
+}
+
+// TestLoweringInvalidDiagnostic checks that errors in generated code are reported at the yield they come after
+func TestLoweringInvalidDiagnostic(t *testing.T) {
+
+	dir := newTestDir(t, "invalid")
+	writeTestFile(t, filepath.Join(dir, "a.go"), fmt.Sprintf(coroutineSrcFmt, "x := 1\nc.Yield(1)\nprintln(x)"))
+
+	var ok bool
+	msg := captureStderr(t, func() { ok = genTestPkg(t, dir) })
+	if ok {
+		t.Fatalf("expected the generated code to not compile")
+	}
+
+	// The yield is on line 7 of the original file
+	expected := filepath.Join(dir, "a.go") + ":7:"
+	if !strings.Contains(msg, expected) || !strings.Contains(msg, "generated code of coroutine 'f' does not compile") {
+		t.Fatalf("expected the error to point at '%s' in coroutine 'f', but got '%s'", expected, msg)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+// yieldMacroFinder finds functions and methods marked with '//cogo:yield'.
+//
+// A yield macro returns a cogo.Yielder, and calling one as a statement inside a coroutine
+// is a suspension point equivalent to 'c.YieldTo(macro(...))'. This lets users build their own
+// vocabulary like 'WaitFrames(3)' on top of YieldTo.
+//
+// The finder is shared between packages that are processed in parallel, so it's safe for concurrent use
+type yieldMacroFinder struct {
+	lock        sync.Mutex
+	fset        *token.FileSet
+	isMacro     map[*types.Func]bool
+	parseFset   *token.FileSet
+	parsedFiles map[string]*ast.File
+}
+
+func newYieldMacroFinder(fset *token.FileSet) *yieldMacroFinder {
+	return &yieldMacroFinder{
+		fset:        fset,
+		isMacro:     map[*types.Func]bool{},
+		parseFset:   token.NewFileSet(),
+		parsedFiles: map[string]*ast.File{},
+	}
+}
+
+// isYieldMacro returns true if fn is declared with a '//cogo:yield' directive. Since fn might come from
+// a package we only have type information for, we find its declaration by parsing the file it's in
+func (m *yieldMacroFinder) isYieldMacro(fn *types.Func) bool {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	isMacro, ok := m.isMacro[fn]
+	if ok {
+		return isMacro
+	}
+
+	funcDecl := m.findFuncDecl(fn)
+	isMacro = funcDecl != nil && getFuncDirectives(m.parseFset, funcDecl).Yield
+	m.isMacro[fn] = isMacro
+
+	if !isMacro {
+		return false
+	}
+
+	// A macro must give us something we can yield to
+	results := fn.Type().(*types.Signature).Results()
+	if results.Len() != 1 || !isYielderType(results.At(0).Type()) {
+		panic(fmt.Sprintf("%s: yield macro '%s' must return exactly one value that implements cogo.Yielder", m.fset.Position(fn.Pos()), fn.Name()))
+	}
+
+	return true
+}
+
+func (m *yieldMacroFinder) findFuncDecl(fn *types.Func) *ast.FuncDecl {
+
+	pos := m.fset.Position(fn.Pos())
+	if pos.Filename == "" {
+		return nil
+	}
+
+	f, ok := m.parsedFiles[pos.Filename]
+	if !ok {
+
+		// Files we can't read (e.g. no source available) simply have no macros
+		f, _ = parser.ParseFile(m.parseFset, pos.Filename, nil, parser.ParseComments)
+		m.parsedFiles[pos.Filename] = f
+	}
+
+	if f == nil {
+		return nil
+	}
+
+	for _, decl := range f.Decls {
+
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if ok && funcDecl.Name.Name == fn.Name() && funcDecl.Doc != nil && m.parseFset.Position(funcDecl.Name.Pos()).Line == pos.Line {
+			return funcDecl
+		}
+	}
+
+	return nil
+}
+
+// isYielderType returns true if t implements cogo.Yielder, which is 'Tick() (done bool)'
+func isYielderType(t types.Type) bool {
+
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "Tick")
+	tickFunc, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+
+	sig := tickFunc.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.Typ[types.Bool])
+}
+
+// getYieldMacroCall returns the call if stmt is a statement calling a yield macro
+func (p *processor) getYieldMacroCall(stmt ast.Stmt) *ast.CallExpr {
+
+	exprStmt, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return nil
+	}
+
+	callExpr, ok := exprStmt.X.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+
+	var fnIdent *ast.Ident
+	switch fun := callExpr.Fun.(type) {
+	case *ast.Ident:
+		fnIdent = fun
+	case *ast.SelectorExpr:
+		fnIdent = fun.Sel
+	default:
+		return nil
+	}
+
+	fn, ok := p.typesInfo.Uses[fnIdent].(*types.Func)
+	if !ok || !p.macros.isYieldMacro(fn) {
+		return nil
+	}
+
+	return callExpr
+}
@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/token"
-	"io"
-	"math/rand"
+	"go/types"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
@@ -17,7 +20,8 @@ import (
 )
 
 var (
-	demo = flag.Bool("demo", false, "")
+	demo  = flag.Bool("demo", false, "")
+	force = flag.Bool("force", false, "regenerate all files even if they are up to date")
 )
 
 func main() {
@@ -34,755 +38,371 @@ func main() {
 		panic(err)
 	}
 
-	genCogoFuncs(cwd)
-	// genHasGenChecksOnOriginalFuncs(cwd)
-}
+	if flag.Arg(0) == "fix" {
 
-func genCogoFuncs(cwd string) {
+		fixFlags := flag.NewFlagSet("fix", flag.ExitOnError)
+		dryRun := fixFlags.Bool("n", false, "only report blocking calls without rewriting them")
+		fixFlags.Parse(flag.Args()[1:])
 
-	pkgs, err := packages.Load(&packages.Config{
-		Dir:   cwd,
-		Mode:  packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
-		Tests: false,
-	})
-	if err != nil {
-		panic(err)
+		fixBlockingCalls(cwd, fixFlags.Args(), *dryRun)
+		return
 	}
 
-	for _, pkg := range pkgs {
+	if flag.Arg(0) == "list" {
+		printCoroutineList(os.Stdout, cwd, loadCoroutines(cwd, flag.Args()[1:]))
+		return
+	}
 
-		p := &processor{
-			fset:             pkg.Fset,
-			funcDeclsToWrite: []*ast.FuncDecl{},
-			BlockInfos:       make([]BlockInfo, 0, 10),
+	if flag.Arg(0) == "explain" {
+
+		if flag.NArg() < 2 {
+			fmt.Fprintln(os.Stderr, "usage: cogo explain <coroutine name> [packages]")
+			os.Exit(2)
 		}
 
-		for i, synFile := range pkg.Syntax {
-			pkg.Syntax[i] = astutil.Apply(synFile, p.nodeProcessor, nil).(*ast.File)
-			// pkg.Syntax[i] = astutil.Apply(synFile, p.genCogoFuncsNodeProcessor, nil).(*ast.File)
+		err := explainCoroutine(os.Stdout, cwd, flag.Arg(1), loadCoroutines(cwd, flag.Args()[2:]))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-			if len(p.funcDeclsToWrite) > 0 {
+		return
+	}
 
-				root := &ast.File{
-					Name:    synFile.Name,
-					Imports: synFile.Imports,
-					Decls:   []ast.Decl{},
-				}
+	if flag.Arg(0) == "graph" {
 
-				for _, v := range p.funcDeclsToWrite {
-					root.Decls = append(root.Decls, &ast.FuncDecl{
-						Name: ast.NewIdent(v.Name.Name + "_cogo"),
-						Type: v.Type,
-						Body: v.Body,
-					})
-				}
+		graphFlags := flag.NewFlagSet("graph", flag.ExitOnError)
+		format := graphFlags.String("format", "dot", "output format of the graphs, either 'dot' or 'mermaid'")
+		graphFlags.Parse(flag.Args()[1:])
 
-				origFName := pkg.Fset.File(synFile.Pos()).Name()
-				newFName := strings.Split(origFName, ".")[0] + ".cogo.go"
-				writeAst(newFName, "// Code generated by 'cogo'; DO NOT EDIT.\n", pkg.Fset, root)
+		printGraphs(os.Stdout, loadCoroutines(cwd, graphFlags.Args()), *format)
+		return
+	}
 
-				p.funcDeclsToWrite = p.funcDeclsToWrite[:0]
-			}
-		}
+	if !genCogoFuncs(cwd, flag.Args(), *force) {
+		os.Exit(1)
 	}
+	// genHasGenChecksOnOriginalFuncs(cwd)
 }
 
-func genHasGenChecksOnOriginalFuncs(cwd string) {
+// genCogoFuncs generates the '_cogo' version of every coroutine in the packages matching patterns.
+// Source files whose generated file is up to date are skipped unless force is true, and packages are processed in parallel.
+//
+// Generated files that fail to type check are reported and not written, in which case false is returned
+func genCogoFuncs(cwd string, patterns []string, force bool) (ok bool) {
 
+	// Listing files is much cheaper than loading types, so we first find which packages actually need work
 	pkgs, err := packages.Load(&packages.Config{
 		Dir:   cwd,
-		Mode:  packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Mode:  packages.NeedName | packages.NeedFiles,
 		Tests: false,
-	})
+	}, patterns...)
 	if err != nil {
 		panic(err)
 	}
 
+	dirtyFileHashes := map[string]string{}
+	dirtyPkgPaths := make([]string, 0, len(pkgs))
 	for _, pkg := range pkgs {
 
-		p := &processor{
-			fset:             pkg.Fset,
-			funcDeclsToWrite: []*ast.FuncDecl{},
-			BlockInfos:       make([]BlockInfo, 0, 10),
+		pkgDirtyFileHashes := findDirtyFiles(pkg.GoFiles, force)
+		if len(pkgDirtyFileHashes) == 0 {
+			continue
 		}
 
-		for i, synFile := range pkg.Syntax {
-
-			pkg.Syntax[i] = astutil.Apply(synFile, p.genHasGenChecksOnOriginalFuncsNodeProcessor, nil).(*ast.File)
-
-			if len(p.funcDeclsToWrite) > 0 {
-				origFName := pkg.Fset.File(synFile.Pos()).Name()
-				writeAst(origFName, "", pkg.Fset, pkg.Syntax[i])
-
-				p.funcDeclsToWrite = p.funcDeclsToWrite[:0]
-			}
+		dirtyPkgPaths = append(dirtyPkgPaths, pkg.PkgPath)
+		for fName, hash := range pkgDirtyFileHashes {
+			dirtyFileHashes[fName] = hash
 		}
 	}
 
-}
-
-type BlockInfo struct {
-	Switch             *ast.SwitchStmt
-	BeforeBlockLblName string
-}
-
-func (s *BlockInfo) addCase(caseStmts []ast.Stmt) int {
-
-	oldCaseCount := s.CaseCount()
-	newCase := getCaseWithStmts([]ast.Expr{
-		ast.NewIdent(fmt.Sprint(oldCaseCount + 1))},
-		caseStmts,
-	)
-
-	s.Switch.Body.List = append(s.Switch.Body.List, newCase)
-	return len(s.Switch.Body.List)
-}
-
-func (s *BlockInfo) CaseCount() int {
-	return len(s.Switch.Body.List)
-}
-
-type processor struct {
-	fset             *token.FileSet
-	funcDeclsToWrite []*ast.FuncDecl
-	BlockInfos       []BlockInfo
-}
-
-func (p *processor) nodeProcessor(c *astutil.Cursor) bool {
-
-	n := c.Node()
-	if n == nil {
-		return false
-	}
-
-	// If not a function or it's empty skip and continue reading the file AST
-	funcDecl, ok := n.(*ast.FuncDecl)
-	if !ok || funcDecl.Body == nil || len(funcDecl.Body.List) == 0 {
+	if len(dirtyPkgPaths) == 0 {
 		return true
 	}
 
-	// Check if function has the required params
-	coroutineParamName := getCoroutineParamNameFromFuncDecl(funcDecl)
-	if coroutineParamName == "" {
-		return false
-	}
-
-	if !blockUsesCogo(funcDecl.Body, coroutineParamName, true) {
-		return false
-	}
-
-	// Generate code for function
-	p.processBlock(nil, funcDecl.Body, -1, coroutineParamName)
-	p.funcDeclsToWrite = append(p.funcDeclsToWrite, funcDecl)
-	return false
-}
-
-func (p *processor) processBlock(parentBlock, blockStmt *ast.BlockStmt, indexInParent int, coroutineParamName string) {
-
-	if !blockUsesCogo(blockStmt, coroutineParamName, true) {
-		return
-	}
-
-	p.pushNewBlock(parentBlock, blockStmt, indexInParent, &ast.SwitchStmt{
-		Tag: ast.NewIdent(coroutineParamName + ".State"),
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{},
-		},
-	})
-	defer p.popSwitch()
-
-	for i := 0; i < len(blockStmt.List); i++ {
-
-		stmt := blockStmt.List[i]
-
-		if ifStmt, ifStmtOk := stmt.(*ast.IfStmt); ifStmtOk {
-
-			p.processBlock(blockStmt, ifStmt.Body, i, coroutineParamName)
-
-		} else if forStmt, forStmtOk := stmt.(*ast.ForStmt); forStmtOk {
-
-			// @TODO: For loops need unique handling to convert to an if statement (if they use cogo)
-			p.processBlock(blockStmt, forStmt.Body, i, coroutineParamName)
-
-		} else if bStmt, blockStmtOk := stmt.(*ast.BlockStmt); blockStmtOk {
-
-			p.processBlock(blockStmt, bStmt, i, coroutineParamName)
-		}
-
-		selExpr, selExprArgs := tryGetSelExprFromStmt(stmt, coroutineParamName, "Yield")
-		if selExpr == nil {
-			continue
-		}
-
-		p.addYield(blockStmt, &i, selExprArgs, coroutineParamName)
+	pkgs, err = packages.Load(&packages.Config{
+		Dir:   cwd,
+		Mode:  packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Tests: false,
+	}, dirtyPkgPaths...)
+	if err != nil {
+		panic(err)
 	}
 
-}
-
-func (p *processor) pushNewBlock(parentBlock, blockStmt *ast.BlockStmt, indexInParent int, switchStmt *ast.SwitchStmt) {
-
-	beforeBlockLblName := getLblNameFromSubStateNum(int32(len(p.BlockInfos)+1), 0)
-	if parentBlock != nil {
-		parentBlock.List = insertIntoArr[ast.Stmt](parentBlock.List, indexInParent, &ast.LabeledStmt{
-			Label: ast.NewIdent(beforeBlockLblName),
-			Stmt:  &ast.EmptyStmt{},
-		})
+	if len(pkgs) == 0 {
+		return true
 	}
 
-	// Add switch to start of block
-	blockStmt.List = insertIntoArr[ast.Stmt](blockStmt.List, 0, switchStmt)
-
-	p.BlockInfos = append(p.BlockInfos, BlockInfo{
-		Switch:             switchStmt,
-		BeforeBlockLblName: beforeBlockLblName,
-	})
-}
-
-func (p *processor) currSwitch() *ast.SwitchStmt {
-	return p.BlockInfos[len(p.BlockInfos)-1].Switch
-}
-
-func (p *processor) currSwitchInfo() *BlockInfo {
-	return &p.BlockInfos[len(p.BlockInfos)-1]
-}
-
-func (p *processor) popSwitch() *ast.SwitchStmt {
-
-	s := p.BlockInfos[len(p.BlockInfos)-1]
-	p.BlockInfos = p.BlockInfos[:len(p.BlockInfos)-1]
-	return s.Switch
-}
-
-func toStr[T any](x T) string {
-	return fmt.Sprintf("%+v", x)
-}
-
-func (p *processor) addYield(block *ast.BlockStmt, listIndex *int, yieldArgs []ast.Expr, coroutineParamName string) {
-
-	// Update switch statements and find the new state value
-	newCaseCondition := p.currSwitchInfo().CaseCount() + 1
-	newLblName := getLblNameFromSubStateNum(int32(len(p.BlockInfos)), int32(newCaseCondition))
-
-	// Go over all switch cases from current inner block to outer most
-	// and add a new case in each to make us reach this new yield
-	p.currSwitchInfo().addCase([]ast.Stmt{
-		&ast.BranchStmt{
-			Tok:   token.GOTO,
-			Label: ast.NewIdent(newLblName),
-		},
-	})
+	macros := newYieldMacroFinder(pkgs[0].Fset)
 
-	stateValNeededForNexSwitch := newCaseCondition
-	prevBlockBeforeLblName := p.currSwitchInfo().BeforeBlockLblName
-	for i := len(p.BlockInfos) - 2; i >= 0; i-- {
+	pkgsChan := make(chan *packages.Package)
+	failed := int32(0)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
 
-		info := &p.BlockInfos[i]
-		info.addCase([]ast.Stmt{
-			&ast.AssignStmt{
-				Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-				Tok: token.ASSIGN,
-				Rhs: []ast.Expr{ast.NewIdent(toStr(stateValNeededForNexSwitch))},
-			},
-			&ast.BranchStmt{
-				Tok:   token.GOTO,
-				Label: ast.NewIdent(prevBlockBeforeLblName),
-			},
-		})
+		wg.Add(1)
+		go func() {
 
-		stateValNeededForNexSwitch = info.CaseCount()
-		prevBlockBeforeLblName = info.BeforeBlockLblName
+			defer wg.Done()
+			for pkg := range pkgsChan {
+				if !genPkgCogoFuncs(pkg, macros, dirtyFileHashes) {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
 	}
 
-	// Create and add yield block
-	newBlock := &ast.BlockStmt{
-		List: []ast.Stmt{
-			&ast.AssignStmt{
-				Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-				Tok: token.ASSIGN,
-				Rhs: []ast.Expr{ast.NewIdent(toStr(stateValNeededForNexSwitch))},
-			},
-			&ast.AssignStmt{
-				Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".Out")},
-				Tok: token.ASSIGN,
-				Rhs: yieldArgs,
-			},
-			&ast.ReturnStmt{},
-		},
+	for _, pkg := range pkgs {
+		pkgsChan <- pkg
 	}
+	close(pkgsChan)
+	wg.Wait()
 
-	block.List[*listIndex] = newBlock
-	block.List = insertIntoArr[ast.Stmt](block.List, *listIndex+1, &ast.LabeledStmt{
-		Label: ast.NewIdent(newLblName),
-		Stmt:  &ast.EmptyStmt{},
-	})
-	*listIndex++
+	return atomic.LoadInt32(&failed) == 0
 }
 
-func (p *processor) genCogoFuncsNodeProcessor(c *astutil.Cursor) bool {
-
-	n := c.Node()
-	if n == nil {
-		return false
-	}
-
-	funcDecl, ok := n.(*ast.FuncDecl)
-	if !ok || funcDecl.Body == nil {
-		return true
-	}
-
-	coroutineParamName := getCoroutineParamNameFromFuncDecl(funcDecl)
-	if coroutineParamName == "" {
-		return false
-	}
-
-	hasBegin := blockHasOneOrMoreSels(funcDecl.Body, []SelExprInfo{{coroutineParamName, "Begin"}}, false)
-	hasYield := blockHasOneOrMoreSels(funcDecl.Body, []SelExprInfo{{coroutineParamName, "Yield"}}, false)
-	if !hasBegin && !hasYield {
-		return false
-	}
-
-	if hasYield && !hasBegin {
-		panic(fmt.Sprintf("Function '%s' in file '%s' has a 'Yield()' call but no 'Begin()'. Please ensure your coroutines have 'Begin()'", funcDecl.Name.Name, p.fset.File(funcDecl.Pos()).Name()))
-	}
-
-	beginBodyListIndex := -1
-	lastCaseEndBodyListIndex := -1
-	mainSwitchStmt := &ast.SwitchStmt{
-		Tag: ast.NewIdent(coroutineParamName + ".State"),
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{},
-		},
-	}
+// genPkgCogoFuncs generates the coroutines of the files in dirtyFileHashes that belong to pkg
+func genPkgCogoFuncs(pkg *packages.Package, macros *yieldMacroFinder, dirtyFileHashes map[string]string) (ok bool) {
 
-	subSwitchStmt := &ast.SwitchStmt{
-		Tag: ast.NewIdent(coroutineParamName + ".SubState"),
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{
-				getCaseWithStmts(nil, []ast.Stmt{}),
-			},
-		},
-	}
+	p := newProcessor(pkg, macros)
 
-	for i := 0; i < len(funcDecl.Body.List); i++ {
+	// A nil source means the generated file is stale and should be removed
+	genFiles := map[string][]byte{}
+	for i, synFile := range pkg.Syntax {
 
-		stmt := funcDecl.Body.List[i]
+		origFName := pkg.Fset.File(synFile.Pos()).Name()
+		srcHash, isDirty := dirtyFileHashes[origFName]
+		if !isDirty || isCogoFile(origFName) {
+			continue
+		}
 
-		var blockStmt *ast.BlockStmt
-		var selExpr *ast.SelectorExpr
+		newFName := getCogoFileName(origFName)
+		if !fileIsIgnored(pkg.Fset, synFile) {
+			p.fileStateDirectives = getStateDirectives(pkg.Fset, synFile)
+			pkg.Syntax[i] = astutil.Apply(synFile, p.nodeProcessor, nil).(*ast.File)
+		}
 
-		if ifStmt, ifStmtOk := stmt.(*ast.IfStmt); ifStmtOk {
+		if len(p.funcDeclsToWrite) == 0 {
 
-			if ifStmtIsHasGen(ifStmt) {
-				funcDecl.Body.List[i] = &ast.EmptyStmt{}
-				continue
+			if isGenFileFromCogo(newFName) {
+				genFiles[newFName] = nil
 			}
 
-			blockStmt = ifStmt.Body
-
-		} else if forStmt, forStmtOk := stmt.(*ast.ForStmt); forStmtOk {
+			continue
+		}
 
-			outInitBlock, postInitStmt, outIfStmt, subStateNums := p.genCogoForStmt(forStmt, coroutineParamName, len(mainSwitchStmt.Body.List))
+		root := &ast.File{
+			Name:    synFile.Name,
+			Imports: synFile.Imports,
+			Decls:   []ast.Decl{},
+		}
 
-			if len(subStateNums) > 1 {
-				panic("For loops currently don't support more than one yield")
+		// Imports are copied so that named imports keep their names. Unused ones are removed when formatting
+		for _, decl := range synFile.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+				root.Decls = append(root.Decls, genDecl)
 			}
+		}
 
-			if len(subStateNums) == 1 {
-
-				// Insert post condition case
-				subSwitchStmt.Body.List = append(subSwitchStmt.Body.List,
-					getCaseWithStmts(
-						[]ast.Expr{ast.NewIdent(fmt.Sprint(subStateNums[0]))},
-						[]ast.Stmt{
-							postInitStmt,
-							&ast.BranchStmt{
-								Tok:   token.GOTO,
-								Label: ast.NewIdent(getLblNameFromSubStateNum(1, subStateNums[0])),
-							},
-						},
-					),
-				)
-
-				// Insert inital condition block
-				funcDecl.Body.List[i] = outInitBlock
-
-				// // Insert lable after initial condition
-				var stmtInterface ast.Stmt = &ast.LabeledStmt{
-					Label: ast.NewIdent(getLblNameFromSubStateNum(1, subStateNums[0])),
-					Stmt:  &ast.EmptyStmt{},
-				}
-				funcDecl.Body.List = insertIntoArr(funcDecl.Body.List, i+1, stmtInterface)
+		cogoPkgName := getCogoPkgName(synFile)
+		for _, v := range p.funcDeclsToWrite {
 
-				// // Replace for with if
-				stmtInterface = outIfStmt
-				funcDecl.Body.List = insertIntoArr(funcDecl.Body.List, i+2, stmtInterface)
-				i += 2
+			genName := getGenFuncName(v, getFuncDirectives(pkg.Fset, v))
+			root.Decls = append(root.Decls, &ast.FuncDecl{
+				Name: ast.NewIdent(genName),
+				Type: v.Type,
+				Body: v.Body,
+			})
+
+			coroutine := p.getCoroutineByGenName(genName)
+			if coroutine == nil || len(coroutine.YieldPoints) == 0 {
 				continue
 			}
 
-		} else if bStmt, blockStmtOk := stmt.(*ast.BlockStmt); blockStmtOk {
-			blockStmt = bStmt
+			root.Decls = append(root.Decls, p.getStateTableDecls(coroutine, cogoPkgName)...)
 		}
 
-		if blockStmt != nil {
-
-			subStateNums := p.genCogoBlockStmt(blockStmt, coroutineParamName, len(mainSwitchStmt.Body.List))
-			for _, subStateNum := range subStateNums {
-
-				subSwitchStmt.Body.List = append(subSwitchStmt.Body.List,
-					getCaseWithStmts(
-						[]ast.Expr{ast.NewIdent(fmt.Sprint(subStateNum))},
-						[]ast.Stmt{
-							&ast.BranchStmt{
-								Tok:   token.GOTO,
-								Label: ast.NewIdent(getLblNameFromSubStateNum(1, subStateNum)),
-							},
-						},
-					),
-				)
-
-				var stmtToInsert ast.Stmt = &ast.LabeledStmt{
-					Label: ast.NewIdent(getLblNameFromSubStateNum(1, subStateNum)),
-					Stmt:  &ast.EmptyStmt{},
-				}
-				funcDecl.Body.List = insertIntoArr(funcDecl.Body.List, i+1, stmtToInsert)
-				i += 1
-			}
-
-			continue
-		}
+		genFiles[newFName] = formatAst(newFName, getGenFileHeader(srcHash), pkg.Fset, root)
+		p.funcDeclsToWrite = p.funcDeclsToWrite[:0]
+	}
 
-		// Find cogo function call in the style of 'cogo.Xyz()'
-		exprStmt, ok := stmt.(*ast.ExprStmt)
-		if !ok {
-			continue
-		}
+	ok = true
+	invalidFiles := p.validateGenFiles(pkg, genFiles)
+	for fName, src := range genFiles {
 
-		callExpr, ok := exprStmt.X.(*ast.CallExpr)
-		if !ok {
-			continue
-		}
-
-		selExpr, ok = callExpr.Fun.(*ast.SelectorExpr)
-		if !ok {
+		if invalidFiles[fName] {
+			ok = false
 			continue
 		}
 
-		if !selExprHasLhsName(selExpr, coroutineParamName) {
+		if src == nil {
+			removeFile(fName)
 			continue
 		}
 
-		// Now that we found a call to cogo decide what to do
-		if selExpr.Sel.Name == "Begin" {
-
-			beginBodyListIndex = i
-			lastCaseEndBodyListIndex = i
-			continue
-		} else if selExpr.Sel.Name == "Yield" {
+		writeFile(fName, src)
+	}
 
-			// Add everything from the last begin/yield until this yield into a case
-			stmtsSinceLastCogo := funcDecl.Body.List[lastCaseEndBodyListIndex+1 : i]
+	return ok
+}
 
-			caseStmts := make([]ast.Stmt, 0, len(stmtsSinceLastCogo)+4)
+// isCogoFile returns true if fName is a file generated by cogo
+func isCogoFile(fName string) bool {
+	return strings.HasSuffix(fName, ".cogo.go")
+}
 
-			caseStmts = append(caseStmts, subSwitchStmt)
-			subSwitchStmt = &ast.SwitchStmt{
-				Tag: ast.NewIdent(coroutineParamName + ".SubState"),
-				Body: &ast.BlockStmt{
-					List: []ast.Stmt{
-						getCaseWithStmts(nil, []ast.Stmt{}),
-					},
-				},
-			}
+// getCogoFileName returns the name of the file holding the generated code of origFName
+func getCogoFileName(origFName string) string {
+	return strings.TrimSuffix(origFName, ".go") + ".cogo.go"
+}
 
-			caseStmts = append(caseStmts, stmtsSinceLastCogo...)
-			caseStmts = append(caseStmts,
-				&ast.IncDecStmt{
-					Tok: token.INC,
-					X:   ast.NewIdent(coroutineParamName + ".State"),
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent("-1")},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".Out")},
-					Tok: token.ASSIGN,
-					Rhs: callExpr.Args,
-				},
-				&ast.ReturnStmt{},
-			)
+func genHasGenChecksOnOriginalFuncs(cwd string) {
 
-			mainSwitchStmt.Body.List = append(mainSwitchStmt.Body.List,
-				getCaseWithStmts(
-					[]ast.Expr{ast.NewIdent(fmt.Sprint(len(mainSwitchStmt.Body.List)))},
-					caseStmts,
-				),
-			)
+	pkgs, err := packages.Load(&packages.Config{
+		Dir:   cwd,
+		Mode:  packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Tests: false,
+	})
+	if err != nil {
+		panic(err)
+	}
 
-			lastCaseEndBodyListIndex = i
+	for _, pkg := range pkgs {
 
-		} else if selExpr.Sel.Name == "YieldTo" {
+		p := &processor{
+			fset:             pkg.Fset,
+			funcDeclsToWrite: []*ast.FuncDecl{},
+		}
 
-			// Add everything from the last begin/yield until this yield into a case
-			stmtsSinceLastCogo := funcDecl.Body.List[lastCaseEndBodyListIndex+1 : i]
+		for i, synFile := range pkg.Syntax {
 
-			caseStmts := make([]ast.Stmt, 0, len(stmtsSinceLastCogo)+5)
+			pkg.Syntax[i] = astutil.Apply(synFile, p.genHasGenChecksOnOriginalFuncsNodeProcessor, nil).(*ast.File)
 
-			caseStmts = append(caseStmts, subSwitchStmt)
-			subSwitchStmt = &ast.SwitchStmt{
-				Tag: ast.NewIdent(coroutineParamName + ".SubState"),
-				Body: &ast.BlockStmt{
-					List: []ast.Stmt{
-						getCaseWithStmts(nil, []ast.Stmt{}),
-					},
-				},
-			}
+			if len(p.funcDeclsToWrite) > 0 {
+				origFName := pkg.Fset.File(synFile.Pos()).Name()
+				writeAst(origFName, "", pkg.Fset, pkg.Syntax[i])
 
-			caseStmts = append(caseStmts, stmtsSinceLastCogo...)
-			caseStmts = append(caseStmts,
-				&ast.IncDecStmt{
-					Tok: token.INC,
-					X:   ast.NewIdent(coroutineParamName + ".State"),
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent("-1")},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".Yielder")},
-					Tok: token.ASSIGN,
-					Rhs: callExpr.Args,
-				},
-				&ast.ReturnStmt{},
-			)
-
-			mainSwitchStmt.Body.List = append(mainSwitchStmt.Body.List,
-				getCaseWithStmts(
-					[]ast.Expr{ast.NewIdent(fmt.Sprint(len(mainSwitchStmt.Body.List)))},
-					caseStmts,
-				),
-			)
-
-			lastCaseEndBodyListIndex = i
-		} else if selExpr.Sel.Name == "YieldNone" {
-
-			// Add everything from the last begin/yield until this yield into a case
-			stmtsSinceLastCogo := funcDecl.Body.List[lastCaseEndBodyListIndex+1 : i]
-
-			caseStmts := make([]ast.Stmt, 0, len(stmtsSinceLastCogo)+5)
-
-			caseStmts = append(caseStmts, subSwitchStmt)
-			subSwitchStmt = &ast.SwitchStmt{
-				Tag: ast.NewIdent(coroutineParamName + ".SubState"),
-				Body: &ast.BlockStmt{
-					List: []ast.Stmt{
-						getCaseWithStmts(nil, []ast.Stmt{}),
-					},
-				},
+				p.funcDeclsToWrite = p.funcDeclsToWrite[:0]
 			}
-
-			caseStmts = append(caseStmts, stmtsSinceLastCogo...)
-			caseStmts = append(caseStmts,
-				&ast.IncDecStmt{
-					Tok: token.INC,
-					X:   ast.NewIdent(coroutineParamName + ".State"),
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent("-1")},
-				},
-				&ast.ReturnStmt{},
-			)
-
-			mainSwitchStmt.Body.List = append(mainSwitchStmt.Body.List,
-				getCaseWithStmts(
-					[]ast.Expr{ast.NewIdent(fmt.Sprint(len(mainSwitchStmt.Body.List)))},
-					caseStmts,
-				),
-			)
-
-			lastCaseEndBodyListIndex = i
 		}
 	}
 
-	// Add everything after the last yield in a separate case
-	stmtsToEndOfFunc := funcDecl.Body.List[lastCaseEndBodyListIndex+1:]
-
-	caseStmts := make([]ast.Stmt, 0, len(stmtsToEndOfFunc)+1)
+}
 
-	caseStmts = append(caseStmts, subSwitchStmt)
-	subSwitchStmt = &ast.SwitchStmt{
-		Tag: ast.NewIdent(coroutineParamName + ".SubState"),
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{
-				getCaseWithStmts(nil, []ast.Stmt{}),
-			},
-		},
+func newProcessor(pkg *packages.Package, macros *yieldMacroFinder) *processor {
+	return &processor{
+		fset:             pkg.Fset,
+		typesPkg:         pkg.Types,
+		typesInfo:        pkg.TypesInfo,
+		macros:           macros,
+		funcDeclsToWrite: []*ast.FuncDecl{},
 	}
+}
 
-	caseStmts = append(caseStmts,
-		&ast.AssignStmt{
-			Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{ast.NewIdent("-1")},
-		},
-		&ast.AssignStmt{
-			Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{ast.NewIdent("-1")},
-		},
-	)
-	caseStmts = append(caseStmts, stmtsToEndOfFunc...)
-
-	mainSwitchStmt.Body.List = append(mainSwitchStmt.Body.List,
-		getCaseWithStmts(
-			[]ast.Expr{ast.NewIdent(fmt.Sprint(len(mainSwitchStmt.Body.List)))},
-			caseStmts,
-		),
-
-		// default case
-		getCaseWithStmts(
-			nil,
-			[]ast.Stmt{
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent("-1")},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent("-1")},
-				},
-				&ast.ReturnStmt{},
-			},
-		),
-	)
-
-	// Apply changes
-	funcDecl.Body.List = funcDecl.Body.List[:beginBodyListIndex]
-	funcDecl.Body.List = append(funcDecl.Body.List,
-		mainSwitchStmt,
-	)
-
-	originalList := funcDecl.Body.List
-	funcDecl.Body.List = make([]ast.Stmt, 0, len(funcDecl.Body.List)+1)
-
-	funcDecl.Body.List = append(funcDecl.Body.List, originalList...)
+type processor struct {
+	fset                *token.FileSet
+	fileStateDirectives []Directive
+	typesPkg            *types.Package
+	typesInfo           *types.Info
+	macros              *yieldMacroFinder
+	// srcHashes are the hashes of the source files of the package, which are only set by loadCoroutines
+	srcHashes        map[string]string
+	funcDeclsToWrite []*ast.FuncDecl
+	Coroutines       []*CoroutineInfo
+}
 
-	p.funcDeclsToWrite = append(p.funcDeclsToWrite, funcDecl)
+// CoroutineInfo holds what we learned about a coroutine while generating its code
+type CoroutineInfo struct {
+	Decl      *ast.FuncDecl
+	GenName   string
+	ParamName string
+	// LblOrigins maps each generated label to the position of the original construct (e.g. a yield) it was created for
+	LblOrigins map[string]token.Pos
+	// YieldPoints are all the places the coroutine can suspend at, in the order they were generated
+	YieldPoints []*YieldPoint
+	// Transitions are the possible moves between yield points, which are identified by their position.
+	// The function's start and end positions are used for entering and finishing the coroutine
+	Transitions []Transition
 
-	return true
+	pinnedStates map[token.Pos]pinnedState
+	usedStates   map[int32]bool
+	nextState    int32
+	lastLblNum   int
 }
 
-/*
-* Init is done in a block just before the for loop condition
-* Post is done in the case that jumps over the loop condition
- */
+func (p *processor) currCoroutine() *CoroutineInfo {
+	return p.Coroutines[len(p.Coroutines)-1]
+}
 
-func (p *processor) genCogoForStmt(forStmt *ast.ForStmt, coroutineParamName string, currCase int) (outInitBlock *ast.BlockStmt, postInitStmt ast.Stmt, outIfStmt *ast.IfStmt, subStateNums []int32) {
+func (p *processor) getCoroutineByGenName(genName string) *CoroutineInfo {
 
-	outInitBlock = &ast.BlockStmt{
-		List: []ast.Stmt{
-			forStmt.Init,
-		},
+	for _, c := range p.Coroutines {
+		if c.GenName == genName {
+			return c
+		}
 	}
 
-	postInitLblNum := rand.Int31() + 1000_000
-	subStateNums = append(subStateNums, postInitLblNum)
+	return nil
+}
+
+func (p *processor) nodeProcessor(c *astutil.Cursor) bool {
 
-	if forStmt.Post == nil {
-		postInitStmt = &ast.EmptyStmt{}
-	} else {
-		postInitStmt = forStmt.Post
+	n := c.Node()
+	if n == nil {
+		return false
 	}
 
-	outIfStmt = &ast.IfStmt{
-		Cond: forStmt.Cond,
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{},
-		},
+	// If not a function or it's empty skip and continue reading the file AST
+	funcDecl, ok := n.(*ast.FuncDecl)
+	if !ok || funcDecl.Body == nil || len(funcDecl.Body.List) == 0 {
+		return true
 	}
 
-	forBodyList := forStmt.Body.List
-	for i, stmt := range forBodyList {
+	funcDirectives := getFuncDirectives(p.fset, funcDecl)
+	if funcDirectives.Ignore {
+		return false
+	}
 
-		selExpr, selExprArgs := tryGetSelExprFromStmt(stmt, coroutineParamName, "Yield")
-		if selExpr == nil {
-			continue
-		}
+	// Check if function has the required params
+	coroutineParamName := resolveCoroutineParamName(p.fset, p.typesInfo, funcDecl, funcDirectives)
+	if coroutineParamName == "" {
+		return false
+	}
 
-		forBodyList[i] = &ast.BlockStmt{
-			List: []ast.Stmt{
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent(fmt.Sprint(currCase))},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent(fmt.Sprint(postInitLblNum))},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".Out")},
-					Tok: token.ASSIGN,
-					Rhs: selExprArgs,
-				},
-				&ast.ReturnStmt{},
-			},
-		}
+	if funcDirectives.Yield || !funcDirectives.Coroutine && !p.usesCogo(funcDecl.Body, coroutineParamName) {
+		return false
 	}
 
-	outIfStmt.Body.List = forBodyList
+	p.Coroutines = append(p.Coroutines, &CoroutineInfo{
+		Decl:         funcDecl,
+		GenName:      getGenFuncName(funcDecl, funcDirectives),
+		ParamName:    coroutineParamName,
+		LblOrigins:   map[string]token.Pos{},
+		pinnedStates: map[token.Pos]pinnedState{},
+		usedStates:   map[int32]bool{},
+	})
+	p.reservePinnedStates(funcDecl.Body, coroutineParamName)
+	p.currCoroutine().Transitions = p.getTransitions(funcDecl, coroutineParamName)
 
-	return outInitBlock, postInitStmt, outIfStmt, subStateNums
+	p.lowerCoroutine(funcDecl, coroutineParamName)
+	p.funcDeclsToWrite = append(p.funcDeclsToWrite, funcDecl)
+	return false
 }
 
-func (p *processor) genCogoBlockStmt(blockStmt *ast.BlockStmt, coroutineParamName string, currCase int) (subStateNums []int32) {
-
-	for i, stmt := range blockStmt.List {
-
-		selExpr, selExprArgs := tryGetSelExprFromStmt(stmt, coroutineParamName, "Yield")
-		if selExpr == nil {
-			continue
-		}
+// typeToStr returns the type as it would be written inside the package being processed, e.g. '*cogo.Sleeper'
+func (p *processor) typeToStr(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string {
 
-		// @TODO: Ensure that subStateNums don't get reused
-		// subStateNum >= 1000_000
-		newSubStateNum := rand.Int31() + 1000_000
-		subStateNums = append(subStateNums, newSubStateNum)
-		blockStmt.List[i] = &ast.BlockStmt{
-			List: []ast.Stmt{
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".State")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent(fmt.Sprint(currCase))},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".SubState")},
-					Tok: token.ASSIGN,
-					Rhs: []ast.Expr{ast.NewIdent(fmt.Sprint(newSubStateNum))},
-				},
-				&ast.AssignStmt{
-					Lhs: []ast.Expr{ast.NewIdent(coroutineParamName + ".Out")},
-					Tok: token.ASSIGN,
-					Rhs: selExprArgs,
-				},
-				&ast.ReturnStmt{},
-			},
+		if pkg == p.typesPkg {
+			return ""
 		}
-	}
 
-	return subStateNums
+		return pkg.Name()
+	})
 }
 
-func getLblNameFromSubStateNum(switchNum, caseNum int32) string {
-	return fmt.Sprintf("cogo_%d_%d", switchNum, caseNum)
+func toStr[T any](x T) string {
+	return fmt.Sprintf("%+v", x)
 }
 
 func insertIntoArr[T any](a []T, index int, value T) []T {
@@ -821,6 +441,55 @@ func tryGetSelExprFromStmt(stmt ast.Stmt, lhs, rhs string) (selExpr *ast.Selecto
 	return nil, nil
 }
 
+// tryGetYieldFromStmt returns the name of the yield function (e.g. 'YieldTo') called by stmt
+// on the coroutine, or an empty string if stmt isn't a yield
+func tryGetYieldFromStmt(stmt ast.Stmt, coroutineParamName string) (yieldFuncName string, args []ast.Expr) {
+
+	// Yields with a value are assigned, like 'v := c.YieldRecv(out)'
+	if assignStmt, ok := stmt.(*ast.AssignStmt); ok {
+
+		if len(assignStmt.Lhs) != 1 || len(assignStmt.Rhs) != 1 {
+			return "", nil
+		}
+
+		for _, name := range valueYieldFuncNames {
+
+			selExpr, args := tryGetSelExprFromStmt(&ast.ExprStmt{X: assignStmt.Rhs[0]}, coroutineParamName, name)
+			if selExpr != nil {
+				return name, args
+			}
+		}
+
+		return "", nil
+	}
+
+	for _, name := range yieldFuncNames {
+
+		selExpr, args := tryGetSelExprFromStmt(stmt, coroutineParamName, name)
+		if selExpr != nil {
+			return name, args
+		}
+	}
+
+	return "", nil
+}
+
+// getYieldFromStmt is like tryGetYieldFromStmt but also handles yield macros, which are treated as a 'YieldTo'
+func (p *processor) getYieldFromStmt(stmt ast.Stmt, coroutineParamName string) (yieldFuncName string, args []ast.Expr) {
+
+	yieldFuncName, args = tryGetYieldFromStmt(stmt, coroutineParamName)
+	if yieldFuncName != "" {
+		return yieldFuncName, args
+	}
+
+	macroCall := p.getYieldMacroCall(stmt)
+	if macroCall != nil {
+		return "YieldTo", []ast.Expr{macroCall}
+	}
+
+	return "", nil
+}
+
 func (p *processor) genHasGenChecksOnOriginalFuncsNodeProcessor(c *astutil.Cursor) bool {
 
 	n := c.Node()
@@ -843,7 +512,7 @@ func (p *processor) genHasGenChecksOnOriginalFuncsNodeProcessor(c *astutil.Curso
 		// If one already exists update it and return
 		ifStmt, ok := stmt.(*ast.IfStmt)
 		if ok && ifStmtIsHasGen(ifStmt) {
-			funcDecl.Body.List[i] = createHasGenIfStmt(funcDecl, coroutineParamName)
+			funcDecl.Body.List[i] = createHasGenIfStmt(getGenFuncName(funcDecl, getFuncDirectives(p.fset, funcDecl)), coroutineParamName)
 			p.funcDeclsToWrite = append(p.funcDeclsToWrite, funcDecl)
 			return true
 		}
@@ -852,7 +521,7 @@ func (p *processor) genHasGenChecksOnOriginalFuncsNodeProcessor(c *astutil.Curso
 	// If the check doesn't exist add it to the beginning of the function
 	origList := funcDecl.Body.List
 	funcDecl.Body.List = make([]ast.Stmt, 0, len(origList)+1)
-	funcDecl.Body.List = append(funcDecl.Body.List, createHasGenIfStmt(funcDecl, coroutineParamName))
+	funcDecl.Body.List = append(funcDecl.Body.List, createHasGenIfStmt(getGenFuncName(funcDecl, getFuncDirectives(p.fset, funcDecl)), coroutineParamName))
 	funcDecl.Body.List = append(funcDecl.Body.List, origList...)
 
 	p.funcDeclsToWrite = append(p.funcDeclsToWrite, funcDecl)
@@ -860,14 +529,14 @@ func (p *processor) genHasGenChecksOnOriginalFuncsNodeProcessor(c *astutil.Curso
 	return true
 }
 
-func createHasGenIfStmt(funcDecl *ast.FuncDecl, coroutineParamName string) *ast.IfStmt {
+func createHasGenIfStmt(genFuncName, coroutineParamName string) *ast.IfStmt {
 	return &ast.IfStmt{
 		Cond: createStmtFromSelFuncCall("cogo", "HasGen").(*ast.ExprStmt).X,
 		Body: &ast.BlockStmt{
 			List: []ast.Stmt{
 				&ast.ExprStmt{
 					X: &ast.CallExpr{
-						Fun:  ast.NewIdent(funcDecl.Name.Name + "_cogo"),
+						Fun:  ast.NewIdent(genFuncName),
 						Args: []ast.Expr{ast.NewIdent(coroutineParamName)},
 					}},
 				&ast.ReturnStmt{},
@@ -902,6 +571,27 @@ func createStmtFromSelFuncCall(lhs, rhs string) ast.Stmt {
 	}
 }
 
+func createSelFuncCallExpr(lhs, rhs string, args ...ast.Expr) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   ast.NewIdent(lhs),
+			Sel: ast.NewIdent(rhs),
+		},
+		Args: args,
+	}
+}
+
+func nodeToStr(fset *token.FileSet, node any) string {
+
+	sb := &strings.Builder{}
+	err := format.Node(sb, fset, node)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return sb.String()
+}
+
 type SelExprInfo struct {
 	// Give `cogo.Yield()`, Lhs would be 'cogo'
 	Lhs string
@@ -909,8 +599,46 @@ type SelExprInfo struct {
 	Rhs string
 }
 
-func blockUsesCogo(block *ast.BlockStmt, coroutineParamName string, checkChildBlocks bool) bool {
-	return blockHasOneOrMoreSels(block, []SelExprInfo{{coroutineParamName, "Yield"}, {coroutineParamName, "YieldTo"}, {coroutineParamName, "YieldNone"}}, checkChildBlocks)
+// yieldFuncNames are the coroutine methods that suspend execution
+var yieldFuncNames = []string{"Yield", "YieldTo", "YieldNone", "YieldRecv", "YieldErr", "YieldToErr"}
+
+// valueYieldFuncNames are the yields that evaluate to a value once the coroutine resumes
+var valueYieldFuncNames = []string{"YieldRecv", "YieldErr", "YieldToErr"}
+
+// suspendFuncNames maps each yield to the coroutine method its generated code suspends with. Yields that evaluate
+// to an error use their own methods, which make the coroutine hand errors to them instead of failing
+var suspendFuncNames = map[string]string{
+	"Yield":      "Suspend",
+	"YieldNone":  "Suspend",
+	"YieldRecv":  "Suspend",
+	"YieldErr":   "SuspendErr",
+	"YieldTo":    "SuspendTo",
+	"YieldToErr": "SuspendToErr",
+}
+
+// usesCogo returns true if node or anything nested in it yields
+func (p *processor) usesCogo(node ast.Node, coroutineParamName string) (usesCogo bool) {
+
+	ast.Inspect(node, func(n ast.Node) bool {
+
+		if usesCogo {
+			return false
+		}
+
+		// Function literals are not part of the coroutine body
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+
+		if stmt, ok := n.(ast.Stmt); ok {
+			yieldFuncName, _ := p.getYieldFromStmt(stmt, coroutineParamName)
+			usesCogo = yieldFuncName != ""
+		}
+
+		return !usesCogo
+	})
+
+	return usesCogo
 }
 
 func blockHasOneOrMoreSels(block *ast.BlockStmt, sels []SelExprInfo, checkChildBlocks bool) bool {
@@ -1014,31 +742,41 @@ func getCaseWithStmts(caseConditions []ast.Expr, bodyStmts []ast.Stmt) *ast.Case
 }
 
 func writeAst(fName, topComment string, fset *token.FileSet, node any) {
+	writeFile(fName, formatAst(fName, topComment, fset, node))
+}
+
+func removeFile(fName string) {
 
-	f, err := os.Create(fName)
+	err := os.Remove(fName)
 	if err != nil {
-		panic("Failed to create file to write new AST. Err: " + err.Error())
+		panic("Failed to remove file " + fName + ". Err: " + err.Error())
 	}
-	defer f.Close()
+}
 
-	if topComment != "" {
-		f.WriteString(topComment)
+func writeFile(fName string, src []byte) {
+
+	err := os.WriteFile(fName, src, 0666)
+	if err != nil {
+		panic("Failed to write file " + fName + ". Err: " + err.Error())
 	}
+}
 
-	err = format.Node(f, fset, node)
+// formatAst returns the formatted source of node with its imports fixed, as it would be written to fName
+func formatAst(fName, topComment string, fset *token.FileSet, node any) []byte {
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(topComment)
+
+	err := format.Node(buf, fset, node)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	b, err := imports.Process(fName, nil, nil)
+	b, err := imports.Process(fName, buf.Bytes(), nil)
 	if err != nil {
 		format.Node(os.Stdout, fset, node)
 		panic("Failed to process imports on file " + fName + ". Err: " + err.Error())
 	}
 
-	f.Seek(0, io.SeekStart)
-	_, err = f.Write(b)
-	if err != nil {
-		panic(err.Error())
-	}
+	return b
 }
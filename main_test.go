@@ -0,0 +1,173 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// copyTestPkg copies the package at testdata/name into a new directory, since generating writes next to the sources
+func copyTestPkg(t *testing.T, name string) (dir string) {
+
+	dir = newTestDir(t, name)
+	srcDir := filepath.Join("testdata", name)
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+
+		src, err := os.ReadFile(filepath.Join(srcDir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writeTestFile(t, filepath.Join(dir, e.Name()), string(src))
+	}
+
+	return dir
+}
+
+// newTestDir creates an empty directory for a test package inside the module, so that the package can import
+// the cogo package and be built with 'go test'. The directory starts with an underscore so that './...' patterns
+// don't match it, and is removed once the test is done
+func newTestDir(t *testing.T, name string) (dir string) {
+
+	dir, err := os.MkdirTemp(".", "_cogotest_"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writeTestFile(t *testing.T, fName, src string) {
+
+	err := os.WriteFile(fName, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestPkg loads the non test files in dir like packages.Load would. Types are checked from source so
+// that the tests don't depend on the export data format of the installed Go version
+func loadTestPkg(t *testing.T, dir string) *packages.Package {
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	astPkgs, err := parser.ParseDir(fset, absDir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := &packages.Package{
+		PkgPath: "github.com/bloeys/cogo/" + filepath.Base(dir),
+		Fset:    fset,
+		TypesInfo: &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			Scopes:     map[ast.Node]*types.Scope{},
+		},
+	}
+
+	// Files are sorted by name like packages.Load does, so that coroutines are always found in the same order
+	for _, astPkg := range astPkgs {
+		for fName := range astPkg.Files {
+			pkg.GoFiles = append(pkg.GoFiles, fName)
+		}
+
+		sort.Strings(pkg.GoFiles)
+		for _, fName := range pkg.GoFiles {
+			pkg.Syntax = append(pkg.Syntax, astPkg.Files[fName])
+		}
+	}
+
+	// Like packages.Load, type errors are kept instead of failing, since files often use coroutines that are only
+	// generated later, like 'cogo.New(test_cogo, 0)'
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			pkg.Errors = append(pkg.Errors, packages.Error{Msg: err.Error(), Kind: packages.TypeError})
+		},
+	}
+
+	pkg.Types, _ = conf.Check(pkg.PkgPath, fset, pkg.Syntax, pkg.TypesInfo)
+	return pkg
+}
+
+// genTestPkg runs the generator on the package in dir and returns whether the generated code was valid
+func genTestPkg(t *testing.T, dir string) (ok bool) {
+
+	pkg := loadTestPkg(t, dir)
+	return genPkgCogoFuncs(pkg, newYieldMacroFinder(pkg.Fset), findDirtyFiles(pkg.GoFiles, false))
+}
+
+// goTest runs 'go test' on the package in dir
+func goTest(t *testing.T, dir string) {
+
+	out, err := exec.Command("go", "test", "./"+dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("tests of the generated code failed: %s\n%s", err, out)
+	}
+}
+
+// expectPanic runs f and returns the message it panicked with
+func expectPanic(t *testing.T, f func()) (msg string) {
+
+	defer func() {
+
+		r := recover()
+		if r == nil {
+			t.Fatalf("expected a panic")
+		}
+
+		msg, _ = r.(string)
+	}()
+
+	f()
+	return ""
+}
+
+// captureStderr runs f and returns what it wrote to os.Stderr
+func captureStderr(t *testing.T, f func()) string {
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpFile.Close()
+
+	stderr := os.Stderr
+	os.Stderr = tmpFile
+	defer func() { os.Stderr = stderr }()
+
+	f()
+
+	out, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
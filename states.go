@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Pinned states derived from names are in [minNamedState, maxNamedState), which keeps
+	// them away from the small sequential numbers given to other yields
+	minNamedState = 1 << 20
+	maxNamedState = 1 << 30
+)
+
+// YieldPoint is a place where a coroutine suspends
+type YieldPoint struct {
+	// State is the value of Coroutine.State() while suspended at this yield
+	State int32
+	// Name is set for yields pinned with '//cogo:state name=xyz'
+	Name string
+	// Kind is the yield function, e.g. 'YieldTo'. Yield macros are a 'YieldTo'
+	Kind string
+	// YielderType is the type of the yielder awaited by a 'YieldTo' or 'YieldToErr'
+	YielderType string
+	Pos         token.Pos
+	LblName     string
+}
+
+type pinnedState struct {
+	Name  string
+	State int32
+}
+
+// getStateDirectives returns all '//cogo:state' directives in the file
+func getStateDirectives(fset *token.FileSet, f *ast.File) (directives []Directive) {
+
+	for _, cg := range f.Comments {
+		for _, d := range parseDirectives(fset, cg) {
+			if d.Name == "state" {
+				directives = append(directives, d)
+			}
+		}
+	}
+
+	return directives
+}
+
+// getStateDirectiveOfStmt returns the '//cogo:state' directive applied to stmt, which is either at the end of
+// the statement's line or on its own line just above the statement
+func (p *processor) getStateDirectiveOfStmt(stmt ast.Stmt) (d Directive, found bool) {
+
+	stmtPos := p.fset.Position(stmt.Pos())
+	for _, d := range p.fileStateDirectives {
+
+		dPos := p.fset.Position(d.Pos)
+		isAtLineEnd := dPos.Line == stmtPos.Line && d.Pos > stmt.Pos()
+		isOnLineAbove := dPos.Line == stmtPos.Line-1 && dPos.Column == stmtPos.Column
+		if isAtLineEnd || isOnLineAbove {
+			return d, true
+		}
+	}
+
+	return Directive{}, false
+}
+
+// reservePinnedStates finds all yields pinned with '//cogo:state name=xyz [value=123]' and reserves their state values.
+// Named yields keep the same state value no matter how the coroutine changes, so persisted states stay valid
+func (p *processor) reservePinnedStates(body *ast.BlockStmt, coroutineParamName string) {
+
+	coroutine := p.currCoroutine()
+	pinnedNames := map[string]bool{}
+	ast.Inspect(body, func(n ast.Node) bool {
+
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+
+		stmt, ok := n.(ast.Stmt)
+		if !ok {
+			return true
+		}
+
+		yieldFuncName, _ := p.getYieldFromStmt(stmt, coroutineParamName)
+		if yieldFuncName == "" {
+			return true
+		}
+
+		d, found := p.getStateDirectiveOfStmt(stmt)
+		if !found {
+			return true
+		}
+
+		pinned := p.getPinnedState(d)
+		if pinnedNames[pinned.Name] {
+			panic(fmt.Sprintf("%s: state name '%s' is used more than once in coroutine '%s'", p.fset.Position(d.Pos), pinned.Name, coroutine.Decl.Name.Name))
+		}
+
+		if coroutine.usedStates[pinned.State] {
+			panic(fmt.Sprintf("%s: state '%s' has the value %d which is already used in coroutine '%s'. Please set a different one with 'value='", p.fset.Position(d.Pos), pinned.Name, pinned.State, coroutine.Decl.Name.Name))
+		}
+
+		pinnedNames[pinned.Name] = true
+		coroutine.usedStates[pinned.State] = true
+		coroutine.pinnedStates[stmt.Pos()] = pinned
+		return true
+	})
+}
+
+func (p *processor) getPinnedState(d Directive) (pinned pinnedState) {
+
+	for k, v := range d.Args {
+
+		switch k {
+		case "name":
+			pinned.Name = v
+		case "value":
+
+			val, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || val <= 0 {
+				panic(fmt.Sprintf("%s: state value must be a positive int32, but got '%s'", p.fset.Position(d.Pos), v))
+			}
+
+			pinned.State = int32(val)
+		default:
+			panic(fmt.Sprintf("%s: unknown argument '%s' to cogo directive 'state'", p.fset.Position(d.Pos), k))
+		}
+	}
+
+	if pinned.Name == "" {
+		panic(fmt.Sprintf("%s: cogo directive 'state' requires a 'name='", p.fset.Position(d.Pos)))
+	}
+
+	// The name is part of the generated state constant
+	if !token.IsIdentifier(pinned.Name) {
+		panic(fmt.Sprintf("%s: state name '%s' must be a valid Go identifier", p.fset.Position(d.Pos), pinned.Name))
+	}
+
+	if pinned.State == 0 {
+
+		h := fnv.New32a()
+		h.Write([]byte(pinned.Name))
+		pinned.State = int32(minNamedState + h.Sum32()%(maxNamedState-minNamedState))
+	}
+
+	return pinned
+}
+
+// addYieldPoint records a new yield and gives it a state value, which is either pinned
+// or the smallest unused value above all previously allocated ones
+func (c *CoroutineInfo) addYieldPoint(yieldStmt ast.Stmt, yieldFuncName string) *YieldPoint {
+
+	yp := &YieldPoint{
+		Kind: yieldFuncName,
+		Pos:  yieldStmt.Pos(),
+	}
+
+	if pinned, ok := c.pinnedStates[yieldStmt.Pos()]; ok {
+		yp.Name = pinned.Name
+		yp.State = pinned.State
+	} else {
+
+		c.nextState++
+		for c.usedStates[c.nextState] {
+			c.nextState++
+		}
+
+		yp.State = c.nextState
+		c.usedStates[yp.State] = true
+	}
+
+	c.YieldPoints = append(c.YieldPoints, yp)
+	return yp
+}
+
+// getStateConstName returns the name of the generated constant holding the state of yp,
+// like 'test_cogo_State1' or 'test_cogo_State_patrol' for pinned states
+func (c *CoroutineInfo) getStateConstName(yp *YieldPoint) string {
+
+	if yp.Name != "" {
+		return c.GenName + "_State_" + yp.Name
+	}
+
+	return c.GenName + "_State" + toStr(yp.State)
+}
+
+// getStateTableDecls returns the declarations of typed constants for all the states of the coroutine, and of an init function
+// that registers the state table with the runtime, so that a suspended coroutine can tell where in the source it's waiting.
+//
+// Generic coroutines only get the constants, since a generic function can't be registered without instantiating it
+func (p *processor) getStateTableDecls(c *CoroutineInfo, cogoPkgName string) []ast.Decl {
+
+	sb := &strings.Builder{}
+	sb.WriteString("package p\n\nconst (\n")
+	for _, yp := range c.YieldPoints {
+		fmt.Fprintf(sb, "%s int32 = %d\n", c.getStateConstName(yp), yp.State)
+	}
+
+	sb.WriteString(")\n")
+	if c.Decl.Type.TypeParams == nil {
+		p.writeRegisterStates(sb, c, cogoPkgName)
+	}
+
+	// Parsing into our file set gives the declarations positions, which the printer uses to lay them out nicely
+	f, err := parser.ParseFile(p.fset, "", sb.String(), 0)
+	if err != nil {
+		panic("Failed to parse state table of coroutine '" + c.Decl.Name.Name + "'. Err: " + err.Error())
+	}
+
+	return f.Decls
+}
+
+// writeRegisterStates writes an init function that registers the states of the coroutine
+func (p *processor) writeRegisterStates(sb *strings.Builder, c *CoroutineInfo, cogoPkgName string) {
+
+	sb.WriteString("\nfunc init() {\n")
+	fmt.Fprintf(sb, "%s.RegisterStates([]%s.StateInfo{\n", cogoPkgName, cogoPkgName)
+	for _, yp := range c.YieldPoints {
+
+		pos := p.fset.Position(yp.Pos)
+		fmt.Fprintf(sb, "{State: %s, ", c.getStateConstName(yp))
+		if yp.Name != "" {
+			fmt.Fprintf(sb, "Label: %q, ", yp.Name)
+		}
+
+		fmt.Fprintf(sb, "Kind: %q, File: %q, Line: %d},\n", yp.Kind, filepath.Base(pos.Filename), pos.Line)
+	}
+
+	// Both the generated function and the original one are registered since either might be passed to cogo.New.
+	// Methods can't be referred to by name, but they don't get generated versions anyway
+	fmt.Fprintf(sb, "}, %s", c.GenName)
+	if c.Decl.Recv == nil {
+		fmt.Fprintf(sb, ", %s", c.Decl.Name.Name)
+	}
+
+	sb.WriteString(")\n}\n")
+}
+
+// getCogoPkgName returns the name the cogo package is imported as in f
+func getCogoPkgName(f *ast.File) string {
+
+	for _, imp := range f.Imports {
+
+		if imp.Path.Value != strconv.Quote(cogoPkgPath) {
+			continue
+		}
+
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+
+		break
+	}
+
+	return "cogo"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// pinnedConstRegexp matches the generated constant of the state pinned with '//cogo:state name=resting'
+var pinnedConstRegexp = regexp.MustCompile(`patrol_cogo_State_resting\s+int32 = (\d+)`)
+
+func TestStateNumberingIsStable(t *testing.T) {
+
+	dir := copyTestPkg(t, "graph")
+	srcFName := filepath.Join(dir, "graph.go")
+	genFName := filepath.Join(dir, "graph.cogo.go")
+
+	generate := func() string {
+
+		os.Remove(genFName)
+		if !genTestPkg(t, dir) {
+			t.Fatalf("expected the package to generate valid code")
+		}
+
+		genSrc, err := os.ReadFile(genFName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(genSrc)
+	}
+
+	genSrc := generate()
+	if generate() != genSrc {
+		t.Fatalf("expected generating the same source twice to give the same code")
+	}
+
+	pinnedState := pinnedConstRegexp.FindStringSubmatch(genSrc)
+	if pinnedState == nil {
+		t.Fatalf("expected a constant for the pinned state, but got:\n%s", genSrc)
+	}
+
+	// A new yield before the pinned one shifts the sequential states, but not the pinned one
+	src, err := os.ReadFile(srcFName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, srcFName, strings.Replace(string(src), "c.Yield(1)", "c.Yield(0)\n\tc.Yield(1)", 1))
+	genSrc = generate()
+	if newPinnedState := pinnedConstRegexp.FindStringSubmatch(genSrc); newPinnedState == nil || newPinnedState[1] != pinnedState[1] {
+		t.Fatalf("expected the pinned state to stay %s after adding a yield, but got:\n%s", pinnedState[1], genSrc)
+	}
+
+	if !regexp.MustCompile(`patrol_cogo_State5\s+int32 = 5`).MatchString(genSrc) {
+		t.Fatalf("expected the new yield to add a sequential state, but got:\n%s", genSrc)
+	}
+}
@@ -0,0 +1,9 @@
+package cache
+
+import "github.com/bloeys/cogo/cogo"
+
+func count(c *cogo.Coroutine[int, int]) {
+	c.Yield(1)
+	wait(2)
+	c.Yield(2)
+}
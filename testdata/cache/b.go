@@ -0,0 +1,7 @@
+package cache
+
+import "github.com/bloeys/cogo/cogo"
+
+func wait(frames int) cogo.Yielder {
+	return cogo.NewFrameWaiter(frames)
+}
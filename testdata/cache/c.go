@@ -0,0 +1,6 @@
+package cache
+
+import "github.com/bloeys/cogo/cogo"
+
+// counters only mentions coroutines, so nothing is generated for this file
+var counters []*cogo.Coroutine[int, int]
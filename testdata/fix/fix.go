@@ -0,0 +1,42 @@
+package fix
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func poll(c *cogo.Coroutine[chan int, int]) {
+
+	c.Yield(1)
+	time.Sleep(time.Millisecond)
+
+	select {
+	case <-c.In:
+	default:
+	}
+
+	<-c.In
+}
+
+// sleep takes a coroutine but never yields, so it's called directly and must keep blocking
+func sleep(c *cogo.Coroutine[chan int, int], d time.Duration) {
+	time.Sleep(d)
+}
+
+type jobs struct {
+	sync.WaitGroup
+}
+
+type batch struct {
+	*jobs
+}
+
+// waitJobs waits on WaitGroups that are embedded, directly and through a pointer
+func waitJobs(c *cogo.Coroutine[batch, int]) {
+
+	c.Yield(1)
+	c.In.Wait()
+	c.In.jobs.Wait()
+}
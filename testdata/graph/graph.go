@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func patrol(c *cogo.Coroutine[int, int]) {
+
+	c.Yield(1)
+	if c.In > 0 {
+		c.Yield(2)
+	} else {
+		c.YieldTo(cogo.NewSleeper(time.Second)) //cogo:state name=resting
+	}
+
+	for c.Out < 10 {
+
+		c.Yield(c.Out + 1)
+		if c.In < 0 {
+			return
+		}
+	}
+
+	c.YieldNone()
+}
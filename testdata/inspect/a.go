@@ -0,0 +1,14 @@
+package inspect
+
+import (
+	"time"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+func count(c *cogo.Coroutine[int, string]) {
+
+	c.Yield("1")
+	c.YieldTo(cogo.NewSleeper(time.Second)) //cogo:state name=sleeping value=7
+	c.Yield("2")
+}
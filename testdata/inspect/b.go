@@ -0,0 +1,7 @@
+package inspect
+
+import "github.com/bloeys/cogo/cogo"
+
+func wait(c *cogo.Coroutine[bool, int]) {
+	c.YieldNone()
+}
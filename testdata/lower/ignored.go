@@ -0,0 +1,10 @@
+//cogo:ignore
+
+// Nothing is generated for this file, since it's ignored
+package lower
+
+import "github.com/bloeys/cogo/cogo"
+
+func ignoredFile(c *cogo.Coroutine[int, int]) {
+	c.Yield(1)
+}
@@ -0,0 +1,168 @@
+package lower
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+// Locals don't survive yields, so coroutines here keep what they need across yields in In and Out
+
+type grid struct {
+	i, j int
+}
+
+func loops(c *cogo.Coroutine[*grid, int]) {
+
+outer:
+	for c.In.i = 0; c.In.i < 3; c.In.i++ {
+		for c.In.j = 0; c.In.j < 3; c.In.j++ {
+
+			if c.In.j == 1 {
+				continue
+			}
+
+			if c.In.i == 1 && c.In.j == 2 {
+				continue outer
+			}
+
+			if c.In.i == 2 {
+				break outer
+			}
+
+			c.Yield(c.In.i*10 + c.In.j)
+		}
+	}
+
+	for {
+		c.Yield(-1)
+		break
+	}
+}
+
+func grades(c *cogo.Coroutine[[]int, string]) {
+
+	for len(c.In) > 0 {
+
+		score := c.In[0]
+		c.In = c.In[1:]
+
+		if score >= 90 {
+			c.Yield("A")
+		} else if score >= 50 {
+			c.Yield("B")
+		} else if score >= 0 {
+			c.Yield("F")
+		} else {
+			c.Yield("?")
+		}
+	}
+}
+
+func initYields(c *cogo.Coroutine[int, int]) {
+
+	if v := c.YieldRecv(1); v > 0 {
+		c.Yield(2)
+	} else {
+		c.Yield(-2)
+	}
+
+	for n := c.YieldRecv(3); n > 0; n-- {
+		c.Out += n
+	}
+
+	c.Yield(c.Out)
+}
+
+func sum(c *cogo.Coroutine[int, int]) {
+
+	for {
+
+		v := c.YieldRecv(c.Out)
+		if v == 0 {
+			break
+		}
+
+		c.Out += v
+	}
+}
+
+var errTimeout = errors.New("timeout")
+
+func waitErr(c *cogo.Coroutine[int, int]) {
+
+	for {
+		if err := c.YieldErr(1); err != nil {
+			c.Out = 100
+			break
+		}
+	}
+
+	err := c.YieldToErr(cogo.New(failing_cogo, 0))
+	if err == errTimeout {
+		c.Yield(2)
+	}
+
+	c.Yield(3)
+}
+
+func failing(c *cogo.Coroutine[int, int]) {
+	c.Yield(1)
+	c.Fail(errTimeout)
+}
+
+var deferLog []string
+
+func deferring(c *cogo.Coroutine[int, int]) {
+
+	defer func() { deferLog = append(deferLog, "first") }()
+
+	for c.Out < 3 {
+		defer fmt.Sprint(c.Out)
+		defer func(n int) { deferLog = append(deferLog, fmt.Sprint("loop ", n)) }(c.Out)
+		c.Yield(c.Out + 1)
+	}
+
+	c.Yield(10)
+}
+
+// waitFrames is a yield macro
+//
+//cogo:yield
+func waitFrames(n int) cogo.Yielder {
+	return cogo.NewFrameWaiter(n)
+}
+
+// named has its generated name and parameter set by a directive, and a pinned state
+//
+//cogo:coroutine name=namedGen param=co
+func named(co *cogo.Coroutine[int, int]) {
+
+	co.Yield(1)
+	waitFrames(2) //cogo:state name=waiting value=50
+	co.Yield(2)
+}
+
+// repeat is generic, so its states get constants but can't be registered
+func repeat[T any](c *cogo.Coroutine[T, T]) {
+	c.Yield(c.In)
+	c.Yield(c.In)
+}
+
+// ignoredFunc isn't generated, since it's ignored
+//
+//cogo:ignore
+func ignoredFunc(c *cogo.Coroutine[int, int]) {
+	c.Yield(1)
+}
+
+type intCoroutine = cogo.Coroutine[int, int]
+
+// aliased reaches its coroutine type through an alias, which needs the directive
+//
+//cogo:coroutine
+func aliased(c *intCoroutine) {
+	c.Yield(1)
+	c.Yield(2)
+}
@@ -0,0 +1,159 @@
+package lower
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bloeys/cogo/cogo"
+)
+
+// collect ticks c until it's done and returns its output after every tick that didn't finish it
+func collect[InT, OutT any](c *cogo.Coroutine[InT, OutT]) (outs []OutT) {
+
+	for !c.Tick() {
+		outs = append(outs, c.Out)
+	}
+
+	return outs
+}
+
+func TestLoops(t *testing.T) {
+
+	outs := collect(cogo.New(loops_cogo, &grid{}))
+	if !reflect.DeepEqual(outs, []int{0, 2, 10, -1}) {
+		t.Fatalf("got %v", outs)
+	}
+}
+
+func TestElseIfChain(t *testing.T) {
+
+	outs := collect(cogo.New(grades_cogo, []int{95, 60, 10, -5}))
+	if !reflect.DeepEqual(outs, []string{"A", "B", "F", "?"}) {
+		t.Fatalf("got %v", outs)
+	}
+}
+
+func TestInitYields(t *testing.T) {
+
+	c := cogo.New(initYields_cogo, 0)
+	c.Tick()
+	if out, _ := c.Resume(5); out != 2 {
+		t.Fatalf("expected the if init to receive the input, but got %d", out)
+	}
+
+	c.Tick()
+	if out, _ := c.Resume(3); out != 9 {
+		t.Fatalf("expected the for init to receive the input, but got %d", out)
+	}
+
+	if !c.Tick() {
+		t.Fatalf("expected coroutine to be done")
+	}
+}
+
+func TestYieldRecv(t *testing.T) {
+
+	c := cogo.New(sum_cogo, 0)
+	c.Tick()
+	c.Resume(2)
+	c.Resume(3)
+	if out, done := c.Resume(0); out != 5 || !done {
+		t.Fatalf("expected a sum of 5 and the coroutine to be done, but got %d", out)
+	}
+}
+
+func TestYieldErr(t *testing.T) {
+
+	// Errors are handled the same when the function isn't the registered one, like with a wrapper
+	c := cogo.New(func(c *cogo.Coroutine[int, int]) { waitErr_cogo(c) }, 0)
+	c.Tick()
+	if c.Throw(errTimeout) || c.Out != 100 {
+		t.Fatalf("expected the error to be handled at the YieldErr, but got %d and '%v'", c.Out, c.Err())
+	}
+
+	// The child fails on its next tick, which is handled at the YieldToErr
+	if c.Tick() || c.Out != 2 {
+		t.Fatalf("expected the child error to be handled at the YieldToErr, but got %d and '%v'", c.Out, c.Err())
+	}
+
+	c.Tick()
+	if !c.Throw(errTimeout) || c.Err() != errTimeout {
+		t.Fatalf("expected an error thrown at a Yield to fail the coroutine, but got '%v'", c.Err())
+	}
+}
+
+func TestDefer(t *testing.T) {
+
+	deferLog = nil
+	outs := collect(cogo.New(deferring_cogo, 0))
+	if !reflect.DeepEqual(outs, []int{1, 2, 3, 10}) || !reflect.DeepEqual(deferLog, []string{"loop 2", "loop 1", "loop 0", "first"}) {
+		t.Fatalf("expected deferred calls to run in reverse once done, but got outputs %v and deferred calls %v", outs, deferLog)
+	}
+
+	deferLog = nil
+	c := cogo.New(deferring_cogo, 0)
+	c.Tick()
+	c.Tick()
+	c.Cancel()
+	if !reflect.DeepEqual(deferLog, []string{"loop 1", "loop 0", "first"}) {
+		t.Fatalf("expected deferred calls to run on cancel, but got %v", deferLog)
+	}
+}
+
+func TestDirectivesAndMacros(t *testing.T) {
+
+	c := cogo.New(namedGen, 0)
+	c.Tick()
+	c.Tick()
+	if c.State() != namedGen_State_waiting || namedGen_State_waiting != 50 {
+		t.Fatalf("expected the macro to yield at the pinned state 50, but got %d", c.State())
+	}
+
+	outs := collect(c)
+	if !reflect.DeepEqual(outs, []int{1, 2}) {
+		t.Fatalf("got %v", outs)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+
+	c := cogo.New(repeat_cogo[string], "a")
+	c.Tick()
+	if c.State() != repeat_cogo_State1 {
+		t.Fatalf("expected the coroutine to be at its first state, but got %d", c.State())
+	}
+
+	outs := append([]string{c.Out}, collect(c)...)
+	if !reflect.DeepEqual(outs, []string{"a", "a"}) {
+		t.Fatalf("got %v", outs)
+	}
+}
+
+func TestAlias(t *testing.T) {
+
+	outs := collect(cogo.New(aliased_cogo, 0))
+	if !reflect.DeepEqual(outs, []int{1, 2}) {
+		t.Fatalf("got %v", outs)
+	}
+}
+
+func TestMacros(t *testing.T) {
+
+	g := &gate{}
+	c := cogo.New(gated_cogo, g)
+	var outs []int
+	for i := 0; i < 8; i++ {
+		c.Tick()
+		outs = append(outs, c.Out)
+	}
+
+	// One tick for the yield, two for the frames and the rest waiting on the gate
+	if !reflect.DeepEqual(outs, []int{1, 1, 1, 2, 2, 2, 2, 2}) || c.Status() != cogo.StatusWaitingOnYielder {
+		t.Fatalf("expected the coroutine to wait on the macros, but got %v with status '%s'", outs, c.Status())
+	}
+
+	g.isOpen = true
+	if !c.Tick() || c.Out != 3 {
+		t.Fatalf("expected the coroutine to finish once the gate opened, but got out %d", c.Out)
+	}
+}
@@ -0,0 +1,27 @@
+package lower
+
+import "github.com/bloeys/cogo/cogo"
+
+// gate opens once set to true
+type gate struct {
+	isOpen bool
+}
+
+// wait is a yield macro that's a method
+//
+//cogo:yield
+func (g *gate) wait() cogo.Yielder {
+	return cogo.NewConditionWaiter(func() bool { return g.isOpen })
+}
+
+// gated uses a macro declared in another file and a macro method. Macro calls that
+// aren't statements don't yield
+func gated(c *cogo.Coroutine[*gate, int]) {
+
+	c.Yield(1)
+	waitFrames(2)
+	c.Yield(2)
+	c.In.wait()
+	_ = waitFrames(1)
+	c.Out = 3
+}
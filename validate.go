@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// validateGenFiles type checks the package as it would be after writing genFiles, which maps file names
+// to their newly generated source (or nil if the file is to be removed). Errors in generated files are reported against the original coroutine
+// construct that produced the broken code.
+//
+// The returned map has the names of generated files that don't compile
+func (p *processor) validateGenFiles(pkg *packages.Package, genFiles map[string][]byte) (invalidFiles map[string]bool) {
+
+	invalidFiles = map[string]bool{}
+	if len(genFiles) == 0 {
+		return invalidFiles
+	}
+
+	fset, syntax, typeErrs := checkPkgWithFiles(pkg, genFiles)
+	for _, typeErr := range typeErrs {
+
+		fName := fset.Position(typeErr.Pos).Filename
+		invalidFiles[fName] = true
+		fmt.Fprintln(os.Stderr, p.getGenErrDiagnostic(fset, syntax[fName], typeErr))
+	}
+
+	return invalidFiles
+}
+
+// checkPkgWithFiles type checks the package as it would be with srcs, which maps file names to their new source (or nil if
+// the file is to be removed), and returns the type errors inside the files of srcs along with their syntax trees
+func checkPkgWithFiles(pkg *packages.Package, srcs map[string][]byte) (fset *token.FileSet, syntax map[string]*ast.File, typeErrs []types.Error) {
+
+	// We parse everything again because the original syntax trees were modified during generation
+	fset = token.NewFileSet()
+	files := make([]*ast.File, 0, len(pkg.Syntax)+len(srcs))
+	for _, synFile := range pkg.Syntax {
+
+		fName := pkg.Fset.File(synFile.Pos()).Name()
+		if _, ok := srcs[fName]; ok {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, fName, nil, 0)
+		if err != nil {
+			panic("Failed to parse file " + fName + ". Err: " + err.Error())
+		}
+		files = append(files, f)
+	}
+
+	syntax = map[string]*ast.File{}
+	for fName, src := range srcs {
+
+		// Files that are going to be removed are not part of the package
+		if src == nil {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, fName, src, 0)
+		if err != nil {
+			panic("Failed to parse generated file " + fName + ". Err: " + err.Error())
+		}
+
+		files = append(files, f)
+		syntax[fName] = f
+	}
+
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+
+			for _, imp := range pkg.Types.Imports() {
+				if imp.Path() == path {
+					return imp, nil
+				}
+			}
+
+			return importer.Default().Import(path)
+		}),
+		Error: func(err error) {
+
+			typeErr, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+
+			if _, ok := syntax[fset.Position(typeErr.Pos).Filename]; ok {
+				typeErrs = append(typeErrs, typeErr)
+			}
+		},
+	}
+
+	// Errors are collected by the Error func above
+	conf.Check(pkg.PkgPath, fset, files, nil)
+	return fset, syntax, typeErrs
+}
+
+// getGenErrDiagnostic returns a message describing typeErr, which happened inside genFile, in terms of the
+// original code. If we can find the coroutine construct (e.g. a yield) responsible for the error we point at it,
+// otherwise we point at the coroutine itself
+func (p *processor) getGenErrDiagnostic(genFset *token.FileSet, genFile *ast.File, typeErr types.Error) string {
+
+	genPos := genFset.Position(typeErr.Pos)
+
+	var coroutine *CoroutineInfo
+	var lblName string
+	for _, decl := range genFile.Decls {
+
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || typeErr.Pos < funcDecl.Pos() || typeErr.Pos >= funcDecl.End() {
+			continue
+		}
+
+		coroutine = p.getCoroutineByGenName(funcDecl.Name.Name)
+		lblName = getLblAtPos(funcDecl.Body, typeErr.Pos)
+		if lblName == "" {
+			lblName = getLblBeforePos(funcDecl.Body, typeErr.Pos)
+		}
+		break
+	}
+
+	if coroutine == nil {
+		return fmt.Sprintf("%s: generated code does not compile: %s", genPos, typeErr.Msg)
+	}
+
+	origPos, ok := coroutine.LblOrigins[lblName]
+	if !ok {
+		origPos = coroutine.Decl.Pos()
+	}
+
+	return fmt.Sprintf("%s: generated code of coroutine '%s' does not compile: %s (at %s)", p.fset.Position(origPos), coroutine.Decl.Name.Name, typeErr.Msg, genPos)
+}
+
+// getLblAtPos returns the label used by the goto or labeled statement at pos, if any
+func getLblAtPos(node ast.Node, pos token.Pos) (lblName string) {
+
+	ast.Inspect(node, func(n ast.Node) bool {
+
+		if n == nil || lblName != "" || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+
+		switch stmt := n.(type) {
+		case *ast.BranchStmt:
+			if stmt.Label != nil {
+				lblName = stmt.Label.Name
+			}
+		case *ast.LabeledStmt:
+			if pos < stmt.Stmt.Pos() {
+				lblName = stmt.Label.Name
+			}
+		}
+
+		return true
+	})
+
+	return lblName
+}
+
+// getLblBeforePos returns the last top level label of the function body before pos. Since generated code is flat,
+// this is usually the yield (or other construct) that the code at pos comes after
+func getLblBeforePos(body *ast.BlockStmt, pos token.Pos) (lblName string) {
+
+	for _, stmt := range body.List {
+
+		if stmt.Pos() >= pos {
+			break
+		}
+
+		if lblStmt, ok := stmt.(*ast.LabeledStmt); ok {
+			lblName = lblStmt.Label.Name
+		}
+	}
+
+	return lblName
+}